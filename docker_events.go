@@ -1,18 +1,101 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"log"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/moby/moby/api/types/events"
 	"github.com/moby/moby/client"
 	"github.com/pedropombeiro/qnapexporter/lib/exporter"
+	"github.com/pedropombeiro/qnapexporter/lib/exporter/prometheus"
 	"github.com/pedropombeiro/qnapexporter/lib/notifications"
+	"github.com/pedropombeiro/qnapexporter/lib/utils"
 )
 
-func handleDockerEvents(ctx context.Context, args httpServerArgs, annotator notifications.Annotator, exporterStatus *exporter.Status) error {
+const (
+	composeProjectAttribute = "com.docker.compose.project"
+
+	defaultDockerEventActions  = "health_status,die,kill,restart,start,stop,update,delete,import,load,prune,install,remove,create,destroy"
+	defaultDockerEventTemplate = "{{.Type}} {{.Action}} {{.ID}} {{.Attributes}}"
+
+	dockerRetryDelay    = 10 * time.Second
+	dockerMaxRetryDelay = 5 * time.Minute
+)
+
+// dockerEventAttributes lists the actor attributes that the Docker daemon adds to the object labels in its events
+var dockerEventAttributes = []string{
+	"container", "destination", "driver", "execDuration", "execID", "exitCode", "image", "name", "propagation",
+	"read/write", "signal", "type",
+}
+
+// dockerEventsConfig selects the Docker events that are posted as annotations, and how they are formatted
+type dockerEventsConfig struct {
+	// types and actions select the object types and actions of the annotated events, an empty list matches everything
+	types   []string
+	actions []string
+	// containers matches the name of the containers whose events are annotated
+	containers *regexp.Regexp
+	// labels matches at least one of the <key>=<value> labels of the annotated events
+	labels   *regexp.Regexp
+	template *template.Template
+}
+
+// dockerEventData is the data available to the annotation template
+type dockerEventData struct {
+	Type       string
+	Action     string
+	ID         string
+	Name       string
+	Attributes string
+	Labels     map[string]string
+	Time       time.Time
+}
+
+func newDockerEventsConfig(types, actions, containers, labels, tmpl string) (dockerEventsConfig, error) {
+	config := dockerEventsConfig{
+		types:   splitList(types),
+		actions: splitList(actions),
+	}
+
+	var err error
+	if containers != "" {
+		if config.containers, err = regexp.Compile(containers); err != nil {
+			return config, fmt.Errorf("parse Docker event container filter: %w", err)
+		}
+	}
+	if labels != "" {
+		if config.labels, err = regexp.Compile(labels); err != nil {
+			return config, fmt.Errorf("parse Docker event label filter: %w", err)
+		}
+	}
+	if config.template, err = template.New("docker").Parse(tmpl); err != nil {
+		return config, fmt.Errorf("parse Docker event template: %w", err)
+	}
+
+	return config, nil
+}
+
+func handleDockerEvents(
+	ctx context.Context,
+	args httpServerArgs,
+	config dockerEventsConfig,
+	cursor *dockerEventCursor,
+	regions *containerRegionMatcher,
+	tags *dockerTagExtractor,
+	counter *prometheus.DockerEventCounter,
+	annotator notifications.Annotator,
+	exporterStatus *exporter.Status,
+) error {
 	exporterStatus.Docker = "Connecting..."
 
 	cli, err := client.New()
@@ -22,7 +105,7 @@ func handleDockerEvents(ctx context.Context, args httpServerArgs, annotator noti
 		return err
 	}
 
-	msgs, errs := dockerEvents(ctx, cli, exporterStatus)
+	msgs, errs := dockerEvents(ctx, cli, cursor.since(), exporterStatus)
 
 	for {
 		select {
@@ -31,21 +114,29 @@ func handleDockerEvents(ctx context.Context, args httpServerArgs, annotator noti
 				exporterStatus.Docker = err.Error()
 				args.logger.Println(err)
 
-				select {
-				case <-time.After(10 * time.Second):
-					// Wait for 10 seconds before retrying connection to Docker daemon
-					msgs, errs = dockerEvents(ctx, cli, exporterStatus)
-					break
-				case <-ctx.Done():
-					break
+				if waitForDockerDaemon(ctx, cli, args.logger, exporterStatus) {
+					// Resume from the last handled event, so that no annotation is posted twice
+					msgs, errs = dockerEvents(ctx, cli, cursor.since(), exporterStatus)
 				}
 			}
 		case msg := <-msgs:
-			t := time.Unix(0, msg.TimeNano)
-			m := strings.Join([]string{string(msg.Type), string(msg.Action), msg.Actor.ID, formatDockerActorAttributes(msg.Actor.Attributes)}, " ")
-			exporterStatus.Docker = m
-			args.logger.Printf("%v: %s\n", t, m)
-			_, _ = annotator.Post(m, t)
+			if cursor.seen(msg.TimeNano) {
+				continue
+			}
+
+			counter.Inc(string(msg.Type), string(msg.Action), containerName(msg))
+			regions.prepare(msg)
+			tags.prepare(msg)
+			// The annotations are posted at most once: an annotation that fails to post is not retried
+			posted, err := postDockerEvent(msg, config, annotator, args.logger, exporterStatus)
+			if err != nil {
+				args.logger.Println(err)
+			}
+
+			// Only persist the cursor after the posted events, rather than rewriting the state file for every event
+			if err := cursor.advance(msg.TimeNano, posted); err != nil {
+				args.logger.Println(err)
+			}
 		case <-ctx.Done():
 			exporterStatus.Docker = "Done"
 			return nil
@@ -53,39 +144,232 @@ func handleDockerEvents(ctx context.Context, args httpServerArgs, annotator noti
 	}
 }
 
-func dockerEvents(ctx context.Context, cli *client.Client, exporterStatus *exporter.Status) (<-chan events.Message, <-chan error) {
-	opts := client.EventsListOptions{
-		Since: "1h",
-		Filters: make(client.Filters).Add("event",
-			// Containers
-			"health_status",
-			"kill",
-			"restart",
-			"start",
-			"stop",
-			"update",
-			// Images
-			"delete",
-			"import",
-			"load",
-			"prune",
-			// Plugins
-			"install",
-			"remove",
-			// Volumes
-			"create",
-			"destroy",
-		),
-	}
-	result := cli.Events(ctx, opts)
+// postDockerEvent posts the event as an annotation, if it passes the filters, returning whether it was posted.
+// It only returns an error if the annotation could not be posted.
+func postDockerEvent(
+	msg events.Message,
+	config dockerEventsConfig,
+	annotator notifications.Annotator,
+	logger *log.Logger,
+	exporterStatus *exporter.Status,
+) (bool, error) {
+	if !config.matches(msg) {
+		return false, nil
+	}
+
+	m, err := config.format(msg)
+	if err != nil {
+		// The template would fail again for this event
+		logger.Println(err)
+		return false, nil
+	}
+	if m == "" {
+		// The template rendered nothing for this event
+		return false, nil
+	}
+
+	t := time.Unix(0, msg.TimeNano)
+	exporterStatus.Docker = m
+	logger.Printf("%v: %s\n", t, m)
+	if _, err := annotator.Post(m, t); err != nil {
+		return false, fmt.Errorf("post Docker event annotation %q: %w", m, err)
+	}
+
+	return true, nil
+}
+
+// waitForDockerDaemon waits until the Docker daemon answers, doubling the delay between attempts up to
+// dockerMaxRetryDelay. It returns false if the context is cancelled in the meantime.
+func waitForDockerDaemon(ctx context.Context, cli *client.Client, logger *log.Logger, exporterStatus *exporter.Status) bool {
+	for delay := dockerRetryDelay; ; delay = min(2*delay, dockerMaxRetryDelay) {
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return false
+		}
+
+		_, err := cli.Ping(ctx, client.PingOptions{})
+		if err == nil {
+			return true
+		}
+
+		exporterStatus.Docker = err.Error()
+		logger.Printf("Docker daemon unavailable: %v\n", err)
+	}
+}
+
+// dockerEvents subscribes to all the Docker events, as they are all counted. The annotation filters
+// are applied by dockerEventsConfig.matches.
+func dockerEvents(ctx context.Context, cli *client.Client, since string, exporterStatus *exporter.Status) (<-chan events.Message, <-chan error) {
+	result := cli.Events(ctx, client.EventsListOptions{Since: since})
 	exporterStatus.Docker = "Waiting for events"
 
 	return result.Messages, result.Err
 }
 
+// dockerEventCursor tracks the time of the last handled Docker event, optionally persisting it
+// to a file so that the exporter resumes from it after a restart
+type dockerEventCursor struct {
+	path     string
+	lastNano int64
+}
+
+// loadDockerEventCursor reads the time of the last handled event from path, if set and present
+func loadDockerEventCursor(path string) (*dockerEventCursor, error) {
+	c := &dockerEventCursor{path: path}
+	if path == "" {
+		return c, nil
+	}
+
+	content, err := utils.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+
+		return c, fmt.Errorf("read Docker event state: %w", err)
+	}
+
+	c.lastNano, err = strconv.ParseInt(content, 10, 64)
+	if err != nil {
+		return c, fmt.Errorf("parse Docker event state %q: %w", path, err)
+	}
+
+	return c, nil
+}
+
+// since returns the start of the Docker event subscription: right after the last handled event,
+// or the last hour if none was handled yet
+func (c *dockerEventCursor) since() string {
+	if c.lastNano == 0 {
+		return "1h"
+	}
+
+	return fmt.Sprintf("%d.%09d", c.lastNano/int64(time.Second), c.lastNano%int64(time.Second))
+}
+
+// seen returns whether the event was already handled, as the daemon also replays the events
+// that happened at the exact time of the subscription start
+func (c *dockerEventCursor) seen(timeNano int64) bool {
+	return timeNano <= c.lastNano
+}
+
+// advance moves the cursor to the given event, writing it to the state file if persist is set
+func (c *dockerEventCursor) advance(timeNano int64, persist bool) error {
+	c.lastNano = timeNano
+	if c.path == "" || !persist {
+		return nil
+	}
+
+	// Write to a temporary file first, so that the state is never left truncated
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, []byte(strconv.FormatInt(timeNano, 10)), 0644); err != nil {
+		return fmt.Errorf("write Docker event state: %w", err)
+	}
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		return fmt.Errorf("write Docker event state: %w", err)
+	}
+
+	return nil
+}
+
+// matches returns whether the event passes the type, action, container name and label filters
+func (c dockerEventsConfig) matches(msg events.Message) bool {
+	if len(c.types) > 0 && !slices.Contains(c.types, string(msg.Type)) {
+		return false
+	}
+	if len(c.actions) > 0 {
+		// Actions such as "health_status: healthy" are matched by their prefix, as the Docker daemon does
+		action, _, _ := strings.Cut(string(msg.Action), ":")
+		if !slices.Contains(c.actions, string(msg.Action)) && !slices.Contains(c.actions, action) {
+			return false
+		}
+	}
+
+	if c.containers != nil {
+		if msg.Type != events.ContainerEventType || !c.containers.MatchString(containerName(msg)) {
+			return false
+		}
+	}
+
+	if c.labels == nil {
+		return true
+	}
+	for k, v := range dockerEventLabels(msg) {
+		if c.labels.MatchString(k + "=" + v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// dockerEventLabels returns the labels of the event object, without the attributes added by the Docker daemon
+func dockerEventLabels(msg events.Message) map[string]string {
+	labels := make(map[string]string, len(msg.Actor.Attributes))
+	for k, v := range msg.Actor.Attributes {
+		if !slices.Contains(dockerEventAttributes, k) {
+			labels[k] = v
+		}
+	}
+
+	return labels
+}
+
+// format renders the annotation text of the event
+func (c dockerEventsConfig) format(msg events.Message) (string, error) {
+	data := dockerEventData{
+		Type:       string(msg.Type),
+		Action:     string(msg.Action),
+		ID:         msg.Actor.ID,
+		Name:       msg.Actor.Attributes["name"],
+		Attributes: formatDockerActorAttributes(msg.Actor.Attributes),
+		Labels:     dockerEventLabels(msg),
+		Time:       time.Unix(0, msg.TimeNano),
+	}
+
+	var text bytes.Buffer
+	if err := c.template.Execute(&text, data); err != nil {
+		return "", fmt.Errorf("format Docker event: %w", err)
+	}
+
+	return strings.TrimSpace(text.String()), nil
+}
+
+// dockerTagExtractor is a tagextractor.TagExtractor that tags the Docker annotations with the Compose project
+// and container name of the event passed to prepare, as the user-defined annotation text cannot be parsed
+type dockerTagExtractor struct {
+	tags []string
+}
+
+// prepare sets the tags of the next annotation from the Docker event it describes
+func (x *dockerTagExtractor) prepare(msg events.Message) {
+	x.tags = nil
+	if project := msg.Actor.Attributes[composeProjectAttribute]; project != "" {
+		x.tags = append(x.tags, project)
+	}
+	if name := containerName(msg); name != "" {
+		x.tags = append(x.tags, name)
+	}
+}
+
+func (x *dockerTagExtractor) Extract(annotation string) (string, []string) {
+	return annotation, x.tags
+}
+
+// containerName returns the name of the container the event is about, if any
+func containerName(msg events.Message) string {
+	if msg.Type != events.ContainerEventType {
+		return ""
+	}
+
+	return msg.Actor.Attributes["name"]
+}
+
+// formatDockerActorAttributes lists the attributes of the event actor in a stable order
 func formatDockerActorAttributes(attr map[string]string) string {
 	var s string
-	for k, v := range attr {
+	for _, k := range slices.Sorted(maps.Keys(attr)) {
 		if strings.HasPrefix(k, "com.docker.") {
 			continue
 		}
@@ -93,7 +377,18 @@ func formatDockerActorAttributes(attr map[string]string) string {
 		if s != "" {
 			s += ","
 		}
-		s += fmt.Sprintf("%s=%s", k, v)
+		s += fmt.Sprintf("%s=%s", k, attr[k])
 	}
 	return "(" + s + ")"
 }
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
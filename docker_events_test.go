@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/moby/moby/api/types/events"
+	"github.com/pedropombeiro/qnapexporter/lib/exporter"
+	"github.com/pedropombeiro/qnapexporter/lib/notifications"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func containerEvent(action events.Action, attributes map[string]string) events.Message {
+	return events.Message{
+		Type:     events.ContainerEventType,
+		Action:   action,
+		Actor:    events.Actor{ID: "0123456789ab", Attributes: attributes},
+		TimeNano: 1577880000000000000,
+	}
+}
+
+func TestNewDockerEventsConfig(t *testing.T) {
+	config, err := newDockerEventsConfig("container, image", defaultDockerEventActions, "", "", defaultDockerEventTemplate)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"container", "image"}, config.types)
+	assert.Contains(t, config.actions, "health_status")
+	assert.Nil(t, config.containers)
+	assert.Nil(t, config.labels)
+
+	_, err = newDockerEventsConfig("", "", "(", "", defaultDockerEventTemplate)
+	assert.Error(t, err)
+	_, err = newDockerEventsConfig("", "", "", "(", defaultDockerEventTemplate)
+	assert.Error(t, err)
+	_, err = newDockerEventsConfig("", "", "", "", "{{.Type")
+	assert.Error(t, err)
+}
+
+func TestDockerEventsConfigMatches(t *testing.T) {
+	plex := containerEvent("start", map[string]string{"name": "plex", composeProjectAttribute: "media"})
+	backup := containerEvent("health_status: healthy", map[string]string{"name": "restic", composeProjectAttribute: "backup"})
+	image := events.Message{Type: events.ImageEventType, Action: "delete", Actor: events.Actor{ID: "sha256:abc"}}
+
+	testCases := map[string]struct {
+		types, actions     string
+		containers, labels string
+		expected           []bool
+	}{
+		"no filters":       {expected: []bool{true, true, true}},
+		"type filter":      {types: "image", expected: []bool{false, false, true}},
+		"action filter":    {actions: "health_status,delete", expected: []bool{false, true, true}},
+		"container filter": {containers: "^pl", expected: []bool{true, false, false}},
+		"label filter":     {labels: "^com.docker.compose.project=backup$", expected: []bool{false, true, false}},
+		"both filters":     {containers: "^pl", labels: "=backup$", expected: []bool{false, false, false}},
+		"not a label":      {labels: "^name=plex$", expected: []bool{false, false, false}},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			config, err := newDockerEventsConfig(tc.types, tc.actions, tc.containers, tc.labels, defaultDockerEventTemplate)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expected, []bool{config.matches(plex), config.matches(backup), config.matches(image)})
+		})
+	}
+}
+
+func TestDockerEventsConfigFormat(t *testing.T) {
+	msg := containerEvent("health_status: healthy", map[string]string{
+		"name":                         "plex",
+		"image":                        "plexinc/pms-docker",
+		composeProjectAttribute:        "media",
+		"com.docker.compose.service":   "plex",
+		"org.opencontainers.image.url": "https://plex.tv",
+	})
+
+	testCases := map[string]struct {
+		template string
+		expected string
+	}{
+		"default template": {
+			template: defaultDockerEventTemplate,
+			expected: "container health_status: healthy 0123456789ab (image=plexinc/pms-docker,name=plex,org.opencontainers.image.url=https://plex.tv)",
+		},
+		"custom template": {
+			template: `{{.Name}} is {{.Action}} ({{index .Labels "com.docker.compose.service"}}) at {{.Time.UTC.Format "15:04"}}`,
+			expected: "plex is health_status: healthy (plex) at 12:00",
+		},
+		"labels without the daemon attributes": {
+			template: `{{len .Labels}} labels`,
+			expected: "3 labels",
+		},
+		"empty template": {
+			template: `{{if eq .Name "other"}}{{.Action}}{{end}}`,
+			expected: "",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			config, err := newDockerEventsConfig("", "", "", "", tc.template)
+			require.NoError(t, err)
+
+			text, err := config.format(msg)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, text)
+		})
+	}
+}
+
+func TestDockerEventCursor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "docker-events")
+
+	c, err := loadDockerEventCursor(path)
+	require.NoError(t, err)
+	assert.Equal(t, "1h", c.since())
+	assert.False(t, c.seen(1577880000000000000))
+
+	require.NoError(t, c.advance(1577880000000000001, false))
+	assert.NoFileExists(t, path)
+
+	require.NoError(t, c.advance(1577880000000000123, true))
+	assert.Equal(t, "1577880000.000000123", c.since())
+	assert.True(t, c.seen(1577880000000000123))
+	assert.False(t, c.seen(1577880000000000124))
+
+	// A new cursor resumes from the persisted event
+	c, err = loadDockerEventCursor(path)
+	require.NoError(t, err)
+	assert.Equal(t, "1577880000.000000123", c.since())
+	assert.NoFileExists(t, path+".tmp")
+
+	require.NoError(t, os.WriteFile(path, []byte("garbage"), 0644))
+	_, err = loadDockerEventCursor(path)
+	assert.Error(t, err)
+}
+
+func TestDockerEventCursorInMemory(t *testing.T) {
+	c, err := loadDockerEventCursor("")
+	require.NoError(t, err)
+
+	require.NoError(t, c.advance(2_000_000_000, true))
+	assert.Equal(t, "2.000000000", c.since())
+}
+
+func TestPostDockerEvent(t *testing.T) {
+	msg := containerEvent("die", map[string]string{"name": "plex"})
+	logger := log.New(io.Discard, "", 0)
+
+	testCases := map[string]struct {
+		containers     string
+		postErr        error
+		expectPost     bool
+		expectedPosted bool
+		expectedErr    bool
+	}{
+		"posted":         {expectPost: true, expectedPosted: true},
+		"filtered out":   {containers: "^sonarr$"},
+		"failed to post": {expectPost: true, postErr: errors.New("grafana is down"), expectedErr: true},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			config, err := newDockerEventsConfig("", "", tc.containers, "", defaultDockerEventTemplate)
+			require.NoError(t, err)
+
+			annotator := &notifications.MockAnnotator{}
+			if tc.expectPost {
+				annotator.On("Post", mock.Anything, time.Unix(0, msg.TimeNano)).Return(1, tc.postErr)
+			}
+
+			posted, err := postDockerEvent(msg, config, annotator, logger, &exporter.Status{})
+			assert.Equal(t, tc.expectedPosted, posted)
+			if tc.expectedErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			annotator.AssertExpectations(t)
+		})
+	}
+}
+
+func TestDockerTagExtractor(t *testing.T) {
+	x := &dockerTagExtractor{}
+
+	x.prepare(containerEvent("die", map[string]string{"name": "plex", composeProjectAttribute: "media"}))
+	text, tags := x.Extract("[backup] plex died")
+	assert.Equal(t, "[backup] plex died", text)
+	assert.Equal(t, []string{"media", "plex"}, tags)
+
+	x.prepare(events.Message{Type: events.ImageEventType, Action: "delete", Actor: events.Actor{ID: "sha256:abc"}})
+	_, tags = x.Extract("image delete")
+	assert.Empty(t, tags)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/moby/moby/api/types/events"
+)
+
+// containerRegion describes the region a Docker event opens or closes
+type containerRegion struct {
+	// key identifies the container and the kind of region (outage or unhealthy period)
+	key    string
+	opens  bool
+	closes bool
+}
+
+// openRegion is a region waiting for the event that closes it
+type openRegion struct {
+	key string
+	id  int
+}
+
+// containerRegionMatcher is a notifications.RegionMatcher that turns container outages into Grafana regions:
+// a die or stop event opens a region that the next start event of the container closes, and likewise
+// for unhealthy and healthy health checks.
+//
+// As the annotation text is user-defined, the region is not derived from it but from the event
+// passed to prepare before the annotation is posted.
+type containerRegionMatcher struct {
+	maxRegions int
+	current    containerRegion
+	// regions lists the open regions, oldest first
+	regions []openRegion
+}
+
+// newContainerRegionMatcher returns a containerRegionMatcher that keeps up to maxRegions open regions,
+// forgetting the oldest ones, e.g. of containers removed while the exporter was not running
+func newContainerRegionMatcher(maxRegions int) *containerRegionMatcher {
+	return &containerRegionMatcher{maxRegions: maxRegions}
+}
+
+// prepare sets the region matched by the next annotation from the Docker event it describes.
+// It is called for every event, so that the regions of removed containers are forgotten even if
+// their destroy event is not annotated.
+func (m *containerRegionMatcher) prepare(msg events.Message) {
+	m.current = containerRegion{}
+	if msg.Type != events.ContainerEventType {
+		return
+	}
+
+	switch msg.Action {
+	case events.ActionDie, events.ActionStop:
+		m.current = containerRegion{key: msg.Actor.ID, opens: true}
+	case events.ActionStart:
+		m.current = containerRegion{key: msg.Actor.ID, closes: true}
+	case events.ActionHealthStatusUnhealthy:
+		m.current = containerRegion{key: msg.Actor.ID + "/health", opens: true}
+	case events.ActionHealthStatusHealthy:
+		m.current = containerRegion{key: msg.Actor.ID + "/health", closes: true}
+	case events.ActionDestroy:
+		// A removed container never starts again, e.g. when run with --rm
+		m.regions = slices.DeleteFunc(m.regions, func(r openRegion) bool {
+			return r.key == msg.Actor.ID || strings.HasPrefix(r.key, msg.Actor.ID+"/")
+		})
+	}
+}
+
+func (m *containerRegionMatcher) Add(id int, _ string) {
+	if !m.current.opens {
+		return
+	}
+
+	// A stop event follows the die event of the same outage, which already opened the region
+	if m.findIndex(m.current.key) != -1 {
+		return
+	}
+
+	m.regions = append(m.regions, openRegion{key: m.current.key, id: id})
+	if len(m.regions) > m.maxRegions {
+		m.regions = m.regions[1:]
+	}
+}
+
+func (m *containerRegionMatcher) Match(_ string) int {
+	if !m.current.closes {
+		return -1
+	}
+
+	idx := m.findIndex(m.current.key)
+	if idx == -1 {
+		return -1
+	}
+	id := m.regions[idx].id
+	m.regions = slices.Delete(m.regions, idx, idx+1)
+
+	return id
+}
+
+func (m *containerRegionMatcher) findIndex(key string) int {
+	return slices.IndexFunc(m.regions, func(r openRegion) bool { return r.key == key })
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/moby/moby/api/types/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainerRegionMatcher(t *testing.T) {
+	m := newContainerRegionMatcher(10)
+	plex := map[string]string{"name": "plex"}
+
+	// A start without a previous outage is a point annotation
+	m.prepare(containerEvent(events.ActionStart, plex))
+	assert.Equal(t, -1, m.Match(""))
+	m.Add(1, "")
+	assert.Empty(t, m.regions)
+
+	// die opens the region, stop belongs to the same outage
+	m.prepare(containerEvent(events.ActionDie, plex))
+	assert.Equal(t, -1, m.Match(""))
+	m.Add(2, "")
+	m.prepare(containerEvent(events.ActionStop, plex))
+	assert.Equal(t, -1, m.Match(""))
+	m.Add(3, "")
+
+	m.prepare(containerEvent(events.ActionHealthStatusUnhealthy, plex))
+	assert.Equal(t, -1, m.Match(""))
+	m.Add(4, "")
+
+	// Image events never match
+	m.prepare(events.Message{Type: events.ImageEventType, Action: events.ActionDelete, Actor: events.Actor{ID: "0123456789ab"}})
+	assert.Equal(t, -1, m.Match(""))
+
+	m.prepare(containerEvent(events.ActionStart, plex))
+	assert.Equal(t, 2, m.Match(""))
+	m.prepare(containerEvent(events.ActionHealthStatusHealthy, plex))
+	assert.Equal(t, 4, m.Match(""))
+	assert.Empty(t, m.regions)
+
+	// The region is closed only once
+	m.prepare(containerEvent(events.ActionStart, plex))
+	assert.Equal(t, -1, m.Match(""))
+}
+
+func TestContainerRegionMatcherForgetsRemovedContainers(t *testing.T) {
+	m := newContainerRegionMatcher(2)
+	plex := map[string]string{"name": "plex"}
+
+	// The regions of a removed container are forgotten
+	m.prepare(containerEvent(events.ActionDie, plex))
+	m.Add(1, "")
+	m.prepare(containerEvent(events.ActionHealthStatusUnhealthy, plex))
+	m.Add(2, "")
+	m.prepare(containerEvent(events.ActionDestroy, plex))
+	assert.Equal(t, -1, m.Match(""))
+	assert.Empty(t, m.regions)
+
+	// Only the most recent regions are kept
+	for idx, id := range []string{"a", "b", "c"} {
+		m.prepare(events.Message{Type: events.ContainerEventType, Action: events.ActionDie, Actor: events.Actor{ID: id}})
+		m.Add(10+idx, "")
+	}
+	assert.Equal(t, []openRegion{{key: "b", id: 11}, {key: "c", id: 12}}, m.regions)
+
+	m.prepare(events.Message{Type: events.ContainerEventType, Action: events.ActionStart, Actor: events.Actor{ID: "a"}})
+	assert.Equal(t, -1, m.Match(""))
+	m.prepare(events.Message{Type: events.ContainerEventType, Action: events.ActionStart, Actor: events.Actor{ID: "c"}})
+	assert.Equal(t, 12, m.Match(""))
+}
@@ -18,6 +18,7 @@ type Exporter interface {
 type Status struct {
 	Branch, Revision, Built, Version string
 
+	Platform          string
 	Uptime            time.Time
 	LastFetch         time.Time
 	LastFetchDuration time.Duration
@@ -29,6 +30,7 @@ type Status struct {
 	Volumes           []string
 	Enclosures        []string
 	DmCaches          []string
-	DmCacheDevice     string
+	DmCacheDevices    []string
 	Docker            string
+	Libvirt           string
 }
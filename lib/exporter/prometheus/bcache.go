@@ -0,0 +1,148 @@
+package prometheus
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pedropombeiro/qnapexporter/lib/utils"
+)
+
+var (
+	bcacheCacheModeRe = regexp.MustCompile(`\[(\w+)\]`)
+
+	// bcacheStates lists the values of /sys/block/bcache*/bcache/state
+	bcacheStates = []string{"no cache", "clean", "dirty", "inconsistent"}
+)
+
+// bcacheStats holds the state of a bcache backing device, as documented in
+// https://docs.kernel.org/admin-guide/bcache.html
+type bcacheStats struct {
+	device       string
+	state        string
+	mode         string
+	dirtyBytes   float64
+	hits         float64
+	misses       float64
+	bypassHits   float64
+	bypassMisses float64
+}
+
+func (e *promExporter) readBcacheDevices() {
+	matches, _ := filepath.Glob(path.Join(blockDir, "bcache*", "bcache"))
+	e.bcacheDevices = make([]string, 0, len(matches))
+	for _, m := range matches {
+		e.bcacheDevices = append(e.bcacheDevices, path.Base(path.Dir(m)))
+	}
+	if len(e.bcacheDevices) > 0 {
+		e.Logger.Printf("Found bcache devices: %v", e.bcacheDevices)
+	}
+}
+
+// readBcacheStats reads the state and lifetime statistics of a bcache device under root
+func readBcacheStats(root, dev string) bcacheStats {
+	dir := path.Join(root, dev, "bcache")
+	stats := bcacheStats{device: dev}
+	number := func(name string) float64 {
+		s, _ := utils.ReadFile(path.Join(dir, name))
+		v, _ := strconv.ParseFloat(s, 64)
+		return v
+	}
+
+	stats.state, _ = utils.ReadFile(path.Join(dir, "state"))
+	if mode, err := utils.ReadFile(path.Join(dir, "cache_mode")); err == nil {
+		if matches := bcacheCacheModeRe.FindStringSubmatch(mode); matches != nil {
+			stats.mode = matches[1]
+		}
+	}
+	if dirty, err := utils.ReadFile(path.Join(dir, "dirty_data")); err == nil {
+		stats.dirtyBytes = parseBcacheSize(dirty)
+	}
+	stats.hits = number("stats_total/cache_hits")
+	stats.misses = number("stats_total/cache_misses")
+	stats.bypassHits = number("stats_total/cache_bypass_hits")
+	stats.bypassMisses = number("stats_total/cache_bypass_misses")
+
+	return stats
+}
+
+// parseBcacheSize parses the human readable sizes printed by bcache, e.g. "1.5G"
+func parseBcacheSize(s string) float64 {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0
+	}
+
+	factor := 1.0
+	if idx := strings.IndexByte("kMGTPEZY", s[len(s)-1]); idx >= 0 {
+		for i := 0; i <= idx; i++ {
+			factor *= 1024
+		}
+		s = s[:len(s)-1]
+	}
+
+	v, _ := strconv.ParseFloat(s, 64)
+	return v * factor
+}
+
+func (e *promExporter) getBcacheMetrics() ([]metric, error) {
+	metrics := make([]metric, 0, len(e.bcacheDevices)*(6+len(bcacheStates)))
+	for _, dev := range e.bcacheDevices {
+		metrics = append(metrics, bcacheMetrics(readBcacheStats(blockDir, dev))...)
+	}
+
+	return metrics, nil
+}
+
+func bcacheMetrics(s bcacheStats) []metric {
+	attr := fmt.Sprintf("device=%q", s.device)
+	metrics := []metric{
+		{
+			name:       "node_bcache_info",
+			attr:       fmt.Sprintf("%s,mode=%q", attr, s.mode),
+			value:      1,
+			help:       "Cache mode of the bcache device",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_bcache_dirty_bytes",
+			attr:       attr,
+			value:      s.dirtyBytes,
+			help:       "Data in the cache that has not yet been written back to the backing device",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_bcache_hits_total",
+			attr:       attr,
+			value:      s.hits,
+			help:       "Number of I/O requests served from the cache",
+			metricType: "counter",
+		},
+		{
+			name:       "node_bcache_misses_total",
+			attr:       attr,
+			value:      s.misses,
+			help:       "Number of I/O requests that missed the cache",
+			metricType: "counter",
+		},
+		{
+			name:       "node_bcache_bypass_hits_total",
+			attr:       attr,
+			value:      s.bypassHits,
+			help:       "Number of I/O requests bypassing the cache that were found in the cache",
+			metricType: "counter",
+		},
+		{
+			name:       "node_bcache_bypass_misses_total",
+			attr:       attr,
+			value:      s.bypassMisses,
+			help:       "Number of I/O requests bypassing the cache that were not found in the cache",
+			metricType: "counter",
+		},
+	}
+
+	return appendStateSetMetrics(metrics, "node_bcache_state", attr, "state", bcacheStates, s.state, "State of the bcache backing device")
+}
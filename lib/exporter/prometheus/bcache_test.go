@@ -0,0 +1,59 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBcacheSize(t *testing.T) {
+	tests := map[string]float64{
+		"":     0,
+		"512":  512,
+		"4.0k": 4 * 1024,
+		"1.5M": 1.5 * 1024 * 1024,
+		"2G":   2 * 1024 * 1024 * 1024,
+	}
+
+	for s, want := range tests {
+		t.Run(s, func(t *testing.T) {
+			assert.Equal(t, want, parseBcacheSize(s))
+		})
+	}
+}
+
+func TestReadBcacheStats(t *testing.T) {
+	root := t.TempDir()
+	writeSysfsFile(t, root, "bcache0/bcache/state", "dirty\n")
+	writeSysfsFile(t, root, "bcache0/bcache/cache_mode", "writethrough [writeback] writearound none\n")
+	writeSysfsFile(t, root, "bcache0/bcache/dirty_data", "1.0M\n")
+	writeSysfsFile(t, root, "bcache0/bcache/stats_total/cache_hits", "1200\n")
+	writeSysfsFile(t, root, "bcache0/bcache/stats_total/cache_misses", "300\n")
+	writeSysfsFile(t, root, "bcache0/bcache/stats_total/cache_bypass_hits", "5\n")
+	writeSysfsFile(t, root, "bcache0/bcache/stats_total/cache_bypass_misses", "7\n")
+
+	stats := readBcacheStats(root, "bcache0")
+
+	assert.Equal(t, bcacheStats{
+		device:       "bcache0",
+		state:        "dirty",
+		mode:         "writeback",
+		dirtyBytes:   1024 * 1024,
+		hits:         1200,
+		misses:       300,
+		bypassHits:   5,
+		bypassMisses: 7,
+	}, stats)
+
+	metrics := bcacheMetrics(stats)
+	require.Len(t, metrics, 6+len(bcacheStates))
+	assert.Equal(t, `device="bcache0",mode="writeback"`, metrics[0].attr)
+	assert.Equal(t, metric{
+		name:       "node_bcache_state",
+		attr:       `device="bcache0",state="dirty"`,
+		value:      1,
+		help:       "State of the bcache backing device",
+		metricType: "gauge",
+	}, metrics[6+2])
+}
@@ -0,0 +1,129 @@
+package prometheus
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pedropombeiro/qnapexporter/lib/utils"
+)
+
+var (
+	halAppValueRe = regexp.MustCompile(`(?m)^\s*([\w ]+?)\s*=\s*(.*?)\s*$`)
+
+	// psuStates lists the states exported for each power supply
+	psuStates = []string{"ok", "failed", "absent", "unknown"}
+
+	// halAppStatuses maps the status values printed by hal_app object queries to the exported states
+	halAppStatuses = map[string]string{
+		"ok":            "ok",
+		"good":          "ok",
+		"normal":        "ok",
+		"fail":          "failed",
+		"failed":        "failed",
+		"failure":       "failed",
+		"fault":         "failed",
+		"faulty":        "failed",
+		"error":         "failed",
+		"abnormal":      "failed",
+		"broken":        "failed",
+		"not ok":        "failed",
+		"absent":        "absent",
+		"not present":   "absent",
+		"not installed": "absent",
+	}
+)
+
+// psuStatus holds the state of a power supply unit as reported by `hal_app --se_sys_get_psu`
+type psuStatus struct {
+	state    string
+	fanSpeed float64
+	hasFan   bool
+}
+
+func (e *promExporter) getChassisMetrics() ([]metric, error) {
+	metrics := make([]metric, 0, 16)
+	if e.halApp != "" {
+		var err error
+		metrics, err = e.appendEnclosureTempMetrics(metrics, e.chassis)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, enc := range append([]qnapEnclosure{e.chassis}, e.enclosures...) {
+			if !enc.connected {
+				continue
+			}
+
+			for psuNum := 0; psuNum < enc.psuCount; psuNum++ {
+				psu := psuStatus{state: "unknown"}
+				output, err := utils.ExecCommand(e.halApp, "--se_sys_get_psu", fmt.Sprintf("enc_sys_id=%s,obj_index=%d", enc.id, psuNum))
+				if err == nil {
+					psu = parsePsuStatus(output)
+				}
+
+				metrics = append(metrics, psuMetrics(enc.id, 1+psuNum, psu)...)
+			}
+		}
+	}
+
+	return appendHwmonFaultMetrics(metrics, hwmonDir), nil
+}
+
+// parseHalAppValues parses the "key = value" lines printed by hal_app object queries
+func parseHalAppValues(output string) map[string]string {
+	values := make(map[string]string)
+	for _, matches := range halAppValueRe.FindAllStringSubmatch(output, -1) {
+		values[strings.ToLower(matches[1])] = matches[2]
+	}
+
+	return values
+}
+
+// parseHalAppStatus returns the state matching the whole status value printed by hal_app, ignoring
+// the case and the repeated spaces, and whether the value is known
+func parseHalAppStatus(status string) (string, bool) {
+	state, ok := halAppStatuses[strings.Join(strings.Fields(strings.ToLower(status)), " ")]
+	return state, ok
+}
+
+func parsePsuStatus(output string) psuStatus {
+	values := parseHalAppValues(output)
+	psu := psuStatus{state: "unknown"}
+
+	state, known := parseHalAppStatus(values["status"])
+	switch {
+	case values["present"] == "0":
+		psu.state = "absent"
+	case known:
+		psu.state = state
+	case values["status"] == "" && values["present"] == "1":
+		psu.state = "ok"
+	}
+
+	if fan, ok := values["fan"]; ok {
+		if v, err := strconv.ParseFloat(strings.Fields(fan + " ")[0], 64); err == nil {
+			psu.fanSpeed = v
+			psu.hasFan = true
+		}
+	}
+
+	return psu
+}
+
+func psuMetrics(enclosure string, psuNum int, psu psuStatus) []metric {
+	attr := fmt.Sprintf(`enclosure=%q,psu="%d"`, enclosure, psuNum)
+	metrics := appendStateSetMetrics(nil, "node_psu_status", attr, "status", psuStates, psu.state, "Status of the power supply unit")
+	if psu.hasFan {
+		metrics = append(metrics, metric{
+			name:       "node_psu_fan_speed_rpm",
+			attr:       attr,
+			value:      psu.fanSpeed,
+			help:       "Speed of the power supply unit fan",
+			metricType: "gauge",
+		})
+	}
+
+	return metrics
+}
@@ -0,0 +1,77 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePsuStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   psuStatus
+	}{
+		{
+			name:   "ok with fan",
+			output: "enc_sys_id = root\nobj_index = 0\npresent = 1\nstatus = OK\nfan = 4320 rpm\n",
+			want:   psuStatus{state: "ok", fanSpeed: 4320, hasFan: true},
+		},
+		{
+			name:   "failed",
+			output: "present = 1\nstatus = Fail\n",
+			want:   psuStatus{state: "failed"},
+		},
+		{
+			name:   "absent",
+			output: "present = 0\n",
+			want:   psuStatus{state: "absent"},
+		},
+		{
+			name:   "present without status",
+			output: "present = 1\n",
+			want:   psuStatus{state: "ok"},
+		},
+		{
+			name:   "not ok",
+			output: "present = 1\nstatus = Not OK\n",
+			want:   psuStatus{state: "failed"},
+		},
+		{
+			name:   "not present",
+			output: "status = Not  Present\n",
+			want:   psuStatus{state: "absent"},
+		},
+		{
+			name:   "unrecognized status",
+			output: "present = 1\nstatus = Booting\n",
+			want:   psuStatus{state: "unknown"},
+		},
+		{
+			name:   "unsupported",
+			output: "error: invalid object",
+			want:   psuStatus{state: "unknown"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parsePsuStatus(tt.output))
+		})
+	}
+}
+
+func TestPsuMetrics(t *testing.T) {
+	metrics := psuMetrics("root", 2, psuStatus{state: "failed", fanSpeed: 0, hasFan: true})
+
+	require.Len(t, metrics, len(psuStates)+1)
+	assert.Equal(t, metric{
+		name:       "node_psu_status",
+		attr:       `enclosure="root",psu="2",status="failed"`,
+		value:      1,
+		help:       "Status of the power supply unit",
+		metricType: "gauge",
+	}, metrics[1])
+	assert.Equal(t, "node_psu_fan_speed_rpm", metrics[len(psuStates)].name)
+}
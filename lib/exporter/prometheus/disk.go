@@ -5,6 +5,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pedropombeiro/qnapexporter/lib/utils"
 	"github.com/shirou/gopsutil/v4/disk"
@@ -19,6 +20,15 @@ func (e *promExporter) getSysInfoHdMetrics() ([]metric, error) {
 	highestAvailable := 0
 
 	for hdnum := 1; hdnum <= e.syshdnum; hdnum++ {
+		if e.isSlotAsleep(hdnum) {
+			// Do not wake up the disk, serve the last known value instead
+			if m, ok := e.hdLastMetrics[hdnum]; ok {
+				metrics = append(metrics, m)
+			}
+			highestAvailable = hdnum
+			continue
+		}
+
 		hdnumStr := strconv.Itoa(hdnum)
 		tempStr, err := utils.ExecCommand(e.getsysinfo, "hdtmp", hdnumStr)
 		if err != nil {
@@ -38,12 +48,20 @@ func (e *promExporter) getSysInfoHdMetrics() ([]metric, error) {
 			return metrics, err
 		}
 
-		metrics = append(metrics, metric{
+		attr := fmt.Sprintf(`hd=%q,smart=%q`, hdnumStr, smart)
+		if dev, ok := e.diskSlots[hdnum]; ok {
+			attr += fmt.Sprintf(`,device=%q`, dev)
+		}
+		m := metric{
 			name:  "node_hdtmp_C",
-			attr:  fmt.Sprintf(`hd=%q,smart=%q`, hdnumStr, smart),
+			attr:  attr,
 			value: temp,
-		})
+		}
+		metrics = append(metrics, m)
 		highestAvailable = hdnum
+
+		m.timestamp = time.Now()
+		e.hdLastMetrics[hdnum] = m
 	}
 
 	// Do not ask for data next time on disks that do not report it
@@ -86,6 +104,28 @@ func (e *promExporter) getFlashCacheStatsMetrics() ([]metric, error) {
 }
 
 func (e *promExporter) getDmCacheStatsMetrics() ([]metric, error) {
+	if e.kernelVersion < 5 {
+		return nil, nil
+	}
+	if len(e.dmCacheClients) == 0 && len(e.dmCacheStatsDevices) == 0 && len(e.dmCacheTargets) == 0 {
+		// e.g. ZFS hosts, which have no SSD cache volumes
+		return nil, nil
+	}
+
+	metrics, err := e.getDmCacheClientMetrics()
+	if err != nil {
+		return nil, err
+	}
+
+	metrics, err = e.appendDmCacheTargetMetrics(metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.appendDmCacheHitMetrics(metrics)
+}
+
+func (e *promExporter) getDmCacheClientMetrics() ([]metric, error) {
 	if len(e.dmCacheClients) == 0 {
 		return nil, nil
 	}
@@ -107,6 +147,9 @@ func (e *promExporter) getDmCacheStatsMetrics() ([]metric, error) {
 				break
 			}
 		}
+		if allocationTokens == nil {
+			continue
+		}
 		attr := fmt.Sprintf("device=%q", cache)
 
 		metrics = appendFloatMetric(metrics, "node_flashcache_cached_blocks", allocationTokens[0], 1, attr, "Number of blocks resident in the cache")
@@ -115,15 +158,22 @@ func (e *promExporter) getDmCacheStatsMetrics() ([]metric, error) {
 		metrics = appendFloatMetric(metrics, "node_dmcache_bytes_total", allocationTokens[1], 1024*1024, attr, "Total number of cache blocks")
 	}
 
-	return e.appendDmCacheHitMetrics(metrics)
+	return metrics, nil
 }
 
 func (e *promExporter) appendDmCacheHitMetrics(metrics []metric) ([]metric, error) {
-	if e.dmCacheDeviceMinorNumber == "" {
-		return metrics, nil
+	var err error
+	for _, cache := range e.dmCacheStatsDevices {
+		metrics, err = appendDmCacheDeviceHitMetrics(metrics, cache)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	cache := fmt.Sprintf("dm-%s", e.dmCacheDeviceMinorNumber)
+	return metrics, nil
+}
+
+func appendDmCacheDeviceHitMetrics(metrics []metric, cache string) ([]metric, error) {
 	dmCacheStatsFilePath := fmt.Sprintf(dmCacheStatsFilePathFormat, cache)
 
 	lines, err := utils.ReadFileLines(dmCacheStatsFilePath)
@@ -166,13 +216,6 @@ func (e *promExporter) appendDmCacheHitMetrics(metrics []metric) ([]metric, erro
 		help:       "Number of times a READ bio has been mapped to the cache",
 		metricType: "counter",
 	})
-	metrics = append(metrics, metric{
-		name:       "node_dmcache_read_hit_total",
-		attr:       attr,
-		value:      readHits,
-		help:       "Number of times a READ bio has been mapped to the cache",
-		metricType: "counter",
-	})
 	metrics = append(metrics, metric{
 		name:       "node_flashcache_reads",
 		attr:       attr,
@@ -180,13 +223,6 @@ func (e *promExporter) appendDmCacheHitMetrics(metrics []metric) ([]metric, erro
 		help:       "Number of times a READ bio has occurred",
 		metricType: "counter",
 	})
-	metrics = append(metrics, metric{
-		name:       "node_dmcache_read_total",
-		attr:       attr,
-		value:      readTotal,
-		help:       "Number of times a READ bio has occurred",
-		metricType: "counter",
-	})
 	if readTotal > 0 {
 		metrics = append(metrics, metric{
 			name:       "node_flashcache_read_hit_percent",
@@ -194,12 +230,6 @@ func (e *promExporter) appendDmCacheHitMetrics(metrics []metric) ([]metric, erro
 			value:      readHits / readTotal * 100,
 			metricType: "counter",
 		})
-		metrics = append(metrics, metric{
-			name:       "node_dmcache_read_hit_percent",
-			attr:       attr,
-			value:      readHits / readTotal * 100,
-			metricType: "counter",
-		})
 	}
 
 	metrics = append(metrics, metric{
@@ -209,13 +239,6 @@ func (e *promExporter) appendDmCacheHitMetrics(metrics []metric) ([]metric, erro
 		help:       "Number of times a WRITE bio has been mapped to the cache",
 		metricType: "counter",
 	})
-	metrics = append(metrics, metric{
-		name:       "node_dmcache_write_hit_total",
-		attr:       attr,
-		value:      writeHits,
-		help:       "Number of times a WRITE bio has been mapped to the cache",
-		metricType: "counter",
-	})
 	metrics = append(metrics, metric{
 		name:       "node_flashcache_writes",
 		attr:       attr,
@@ -223,13 +246,6 @@ func (e *promExporter) appendDmCacheHitMetrics(metrics []metric) ([]metric, erro
 		help:       "Number of times a WRITE bio has occurred",
 		metricType: "counter",
 	})
-	metrics = append(metrics, metric{
-		name:       "node_dmcache_write_total",
-		attr:       attr,
-		value:      writeTotal,
-		help:       "Number of times a WRITE bio has occurred",
-		metricType: "counter",
-	})
 	if writeTotal > 0 {
 		metrics = append(metrics, metric{
 			name:       "node_flashcache_write_hit_percent",
@@ -237,15 +253,9 @@ func (e *promExporter) appendDmCacheHitMetrics(metrics []metric) ([]metric, erro
 			value:      writeHits / writeTotal * 100,
 			metricType: "counter",
 		})
-		metrics = append(metrics, metric{
-			name:       "node_dmcache_write_hit_percent",
-			attr:       attr,
-			value:      writeHits / writeTotal * 100,
-			metricType: "counter",
-		})
 	}
 
-	return metrics, nil
+	return append(metrics, dmCacheHitRatioMetrics(attr, readHits, readTotal, writeHits, writeTotal)...), nil
 }
 
 func appendFloatMetric(metrics []metric, metricName string, valueStr string, factor float64, attr string, help string) []metric {
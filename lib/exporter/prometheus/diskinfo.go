@@ -0,0 +1,267 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pedropombeiro/qnapexporter/lib/utils"
+)
+
+// ataPortRe matches the ATA port in the sysfs path of a SATA disk, e.g.
+// /sys/devices/pci0000:00/0000:00:17.0/ata3/host2/target2:0:0/2:0:0:0/block/sda
+var ataPortRe = regexp.MustCompile(`^ata(\d+)$`)
+
+// diskInfo describes the hardware inventory of a disk and where it is installed
+type diskInfo struct {
+	slot          string
+	enclosure     string
+	device        string
+	model         string
+	serial        string
+	firmware      string
+	rotationRate  float64
+	capacityBytes float64
+}
+
+// readDiskInventory maps the QNAP disk slot numbers used by getsysinfo to kernel device names,
+// and reads the hardware inventory of each disk from sysfs
+func (e *promExporter) readDiskInventory() {
+	e.diskSlots = make(map[int]string)
+	enclosures := make(map[string]string)
+	slots := make(map[string]string)
+	if e.halApp != "" {
+		encIDs := []string{"root"}
+		for _, enc := range e.enclosures {
+			if enc.connected {
+				encIDs = append(encIDs, enc.id)
+			}
+		}
+
+		for _, encID := range encIDs {
+			output, err := utils.ExecCommand(e.halApp, "--pd_enum", "enc_sys_id="+encID)
+			if err != nil {
+				e.Logger.Printf("Failed to enumerate physical disks in enclosure %q: %v", encID, err)
+			}
+
+			encDisks := make(map[int]string)
+			for _, row := range parseHalAppTable(output) {
+				slot, err := strconv.Atoi(row["port_id"])
+				if err != nil {
+					continue
+				}
+
+				device := row["sys_name"]
+				if device == "" {
+					device = row["pd_sys_name"]
+				}
+				if device == "" {
+					continue
+				}
+
+				device = path.Base(device)
+				encDisks[slot] = device
+				slots[device] = strconv.Itoa(slot)
+				enclosures[device] = encID
+			}
+
+			if encID == "root" {
+				// getsysinfo only numbers the disks installed in the NAS itself
+				e.diskSlots = encDisks
+				continue
+			}
+			for idx := range e.enclosures {
+				if e.enclosures[idx].id == encID {
+					e.enclosures[idx].disks = encDisks
+				}
+			}
+		}
+		e.Logger.Printf("Found disk slots: %v", e.diskSlots)
+	} else if e.genericLinux {
+		e.diskSlots = readAtaDiskSlots(blockDir, e.devices)
+		for slot, dev := range e.diskSlots {
+			slots[dev] = strconv.Itoa(slot)
+		}
+		e.Logger.Printf("Found disk slots from ATA ports: %v", e.diskSlots)
+	}
+
+	e.disks = make([]diskInfo, 0, len(e.devices))
+	for _, dev := range e.devices {
+		info := readSysfsDiskInfo(blockDir, dev)
+		info.slot = slots[dev]
+		info.enclosure = enclosures[dev]
+		e.disks = append(e.disks, info)
+	}
+}
+
+// readAtaDiskSlots numbers the SATA disks by the ATA port they are connected to, as the closest
+// equivalent of the QNAP slot numbers on hosts without hal_app
+func readAtaDiskSlots(root string, devices []string) map[int]string {
+	slots := make(map[int]string)
+	for _, dev := range devices {
+		target, err := filepath.EvalSymlinks(path.Join(root, dev))
+		if err != nil {
+			continue
+		}
+
+		for _, part := range strings.Split(target, "/") {
+			if matches := ataPortRe.FindStringSubmatch(part); matches != nil {
+				slot, _ := strconv.Atoi(matches[1])
+				slots[slot] = dev
+				break
+			}
+		}
+	}
+
+	return slots
+}
+
+// readSysfsDiskInfo reads the model, serial, firmware, rotation rate and capacity of a
+// block device from sysfs, without issuing any command to the disk itself
+func readSysfsDiskInfo(root, dev string) diskInfo {
+	info := diskInfo{device: dev}
+	deviceDir := path.Join(root, dev, "device")
+
+	readAttr := func(names ...string) string {
+		for _, name := range names {
+			if s, err := utils.ReadFile(path.Join(deviceDir, name)); err == nil && s != "" {
+				return s
+			}
+		}
+		return ""
+	}
+
+	// SCSI disks expose vendor/model/rev, NVMe namespaces expose the controller's model/serial/firmware_rev
+	info.model = strings.TrimSpace(strings.Join([]string{readAttr("vendor"), readAttr("model")}, " "))
+	if strings.HasPrefix(info.model, "ATA ") {
+		info.model = strings.TrimPrefix(info.model, "ATA ")
+	}
+	info.firmware = readAttr("firmware_rev", "rev")
+	info.serial = readAttr("serial")
+	if info.serial == "" {
+		if vpd, err := os.ReadFile(path.Join(deviceDir, "vpd_pg80")); err == nil {
+			info.serial = parseVpdUnitSerialNumber(vpd)
+		}
+	}
+
+	if vpd, err := os.ReadFile(path.Join(deviceDir, "vpd_pgb1")); err == nil {
+		info.rotationRate = parseVpdRotationRate(vpd)
+	} else if rotational, err := utils.ReadFile(path.Join(root, dev, "queue", "rotational")); err == nil && rotational == "0" {
+		info.rotationRate = 0
+	} else {
+		info.rotationRate = -1
+	}
+
+	if sectors, err := utils.ReadFile(path.Join(root, dev, "size")); err == nil {
+		if v, err := strconv.ParseFloat(sectors, 64); err == nil {
+			// sysfs always reports the size in 512-byte sectors
+			info.capacityBytes = v * 512
+		}
+	}
+
+	return info
+}
+
+// parseVpdUnitSerialNumber parses the SCSI Unit Serial Number VPD page (0x80)
+func parseVpdUnitSerialNumber(vpd []byte) string {
+	if len(vpd) < 4 {
+		return ""
+	}
+
+	length := int(binary.BigEndian.Uint16(vpd[2:4]))
+	if len(vpd) < 4+length {
+		length = len(vpd) - 4
+	}
+
+	return strings.TrimSpace(string(vpd[4 : 4+length]))
+}
+
+// parseVpdRotationRate parses the medium rotation rate from the SCSI Block Device
+// Characteristics VPD page (0xb1), returning 0 for non-rotating media and -1 if not reported
+func parseVpdRotationRate(vpd []byte) float64 {
+	if len(vpd) < 6 {
+		return -1
+	}
+
+	switch rate := binary.BigEndian.Uint16(vpd[4:6]); rate {
+	case 0:
+		return -1
+	case 1:
+		return 0
+	default:
+		return float64(rate)
+	}
+}
+
+func (e *promExporter) getDiskInfoMetrics() ([]metric, error) {
+	metrics := make([]metric, 0, len(e.disks)*2)
+	for _, d := range e.disks {
+		attr := fmt.Sprintf(`device=%q,slot=%q`, d.device, d.slot)
+		metrics = append(
+			metrics,
+			metric{
+				name: "node_disk_info",
+				attr: fmt.Sprintf(
+					`%s,enclosure=%q,model=%q,serial=%q,firmware=%q,rotation_rate=%q`,
+					attr, d.enclosure, d.model, d.serial, d.firmware, formatRotationRate(d.rotationRate),
+				),
+				value:      1,
+				help:       "Hardware inventory of the disk and the QNAP slot it is installed in",
+				metricType: "gauge",
+			},
+			metric{
+				name:       "node_disk_capacity_bytes",
+				attr:       attr,
+				value:      d.capacityBytes,
+				help:       "Capacity of the disk in bytes",
+				metricType: "gauge",
+			},
+		)
+	}
+
+	return metrics, nil
+}
+
+func formatRotationRate(rate float64) string {
+	switch {
+	case rate < 0:
+		return "unknown"
+	case rate == 0:
+		return "ssd"
+	default:
+		return strconv.FormatFloat(rate, 'f', 0, 64)
+	}
+}
+
+// parseHalAppTable parses the tabular output of hal_app enumeration commands into
+// one map per row, keyed by the column names in the header line
+func parseHalAppTable(output string) []map[string]string {
+	var header []string
+	var rows []map[string]string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if header == nil {
+			header = fields
+			continue
+		}
+
+		row := make(map[string]string, len(header))
+		for idx, name := range header {
+			if idx < len(fields) {
+				row[name] = fields[idx]
+			}
+		}
+		rows = append(rows, row)
+	}
+
+	return rows
+}
@@ -0,0 +1,83 @@
+package prometheus
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHalAppTable(t *testing.T) {
+	rows := parseHalAppTable(`enc_sys_id  port_id  sys_name
+root        1        /dev/sda
+root        2        /dev/sdb
+`)
+
+	require.Len(t, rows, 2)
+	assert.Equal(t, map[string]string{"enc_sys_id": "root", "port_id": "1", "sys_name": "/dev/sda"}, rows[0])
+	assert.Equal(t, "/dev/sdb", rows[1]["sys_name"])
+}
+
+func TestReadSysfsDiskInfo(t *testing.T) {
+	root := t.TempDir()
+	writeSysfsFile(t, root, "sdc/device/vendor", "ATA     \n")
+	writeSysfsFile(t, root, "sdc/device/model", "WDC WD40EFRX-68N\n")
+	writeSysfsFile(t, root, "sdc/device/rev", "0A82\n")
+	writeSysfsFile(t, root, "sdc/device/vpd_pg80", "\x00\x80\x00\x0a  WD-WCC7K\x00")
+	writeSysfsFile(t, root, "sdc/device/vpd_pgb1", "\x00\xb1\x00\x3c\x1c\x20")
+	writeSysfsFile(t, root, "sdc/size", "7814037168\n")
+	writeSysfsFile(t, root, "nvme0n1/device/model", "Samsung SSD 970 EVO Plus 1TB\n")
+	writeSysfsFile(t, root, "nvme0n1/device/serial", "S4EWNX0R123456\n")
+	writeSysfsFile(t, root, "nvme0n1/device/firmware_rev", "2B2QEXM7\n")
+	writeSysfsFile(t, root, "nvme0n1/queue/rotational", "0\n")
+	writeSysfsFile(t, root, "nvme0n1/size", "1953525168\n")
+
+	assert.Equal(t, diskInfo{
+		device:        "sdc",
+		model:         "WDC WD40EFRX-68N",
+		serial:        "WD-WCC7K",
+		firmware:      "0A82",
+		rotationRate:  7200,
+		capacityBytes: 7814037168 * 512,
+	}, readSysfsDiskInfo(root, "sdc"))
+
+	assert.Equal(t, diskInfo{
+		device:        "nvme0n1",
+		model:         "Samsung SSD 970 EVO Plus 1TB",
+		serial:        "S4EWNX0R123456",
+		firmware:      "2B2QEXM7",
+		rotationRate:  0,
+		capacityBytes: 1953525168 * 512,
+	}, readSysfsDiskInfo(root, "nvme0n1"))
+}
+
+func TestReadAtaDiskSlots(t *testing.T) {
+	root := t.TempDir()
+	writeSysfsFile(t, root, "devices/pci0000:00/0000:00:17.0/ata3/host2/target2:0:0/2:0:0:0/block/sda/size", "0\n")
+	writeSysfsFile(t, root, "devices/pci0000:00/0000:00:17.0/ata1/host0/target0:0:0/0:0:0:0/block/sdb/size", "0\n")
+	writeSysfsFile(t, root, "devices/pci0000:00/0000:00:14.0/usb2/2-1/host6/target6:0:0/6:0:0:0/block/sdc/size", "0\n")
+	require.NoError(t, os.MkdirAll(path.Join(root, "block"), 0o755))
+	require.NoError(t, os.Symlink(path.Join(root, "devices/pci0000:00/0000:00:17.0/ata3/host2/target2:0:0/2:0:0:0/block/sda"), path.Join(root, "block/sda")))
+	require.NoError(t, os.Symlink(path.Join(root, "devices/pci0000:00/0000:00:17.0/ata1/host0/target0:0:0/0:0:0:0/block/sdb"), path.Join(root, "block/sdb")))
+	require.NoError(t, os.Symlink(path.Join(root, "devices/pci0000:00/0000:00:14.0/usb2/2-1/host6/target6:0:0/6:0:0:0/block/sdc"), path.Join(root, "block/sdc")))
+
+	slots := readAtaDiskSlots(path.Join(root, "block"), []string{"sda", "sdb", "sdc", "nvme0n1"})
+
+	assert.Equal(t, map[int]string{1: "sdb", 3: "sda"}, slots)
+}
+
+func TestFormatRotationRate(t *testing.T) {
+	assert.Equal(t, "unknown", formatRotationRate(-1))
+	assert.Equal(t, "ssd", formatRotationRate(0))
+	assert.Equal(t, "5400", formatRotationRate(5400))
+}
+
+func writeSysfsFile(t *testing.T, root, name, contents string) {
+	t.Helper()
+
+	p := path.Join(root, name)
+	require.NoError(t, os.MkdirAll(path.Dir(p), 0o755))
+	require.NoError(t, os.WriteFile(p, []byte(contents), 0o644))
+}
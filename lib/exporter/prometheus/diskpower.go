@@ -0,0 +1,154 @@
+package prometheus
+
+import (
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/pedropombeiro/qnapexporter/lib/utils"
+)
+
+const (
+	diskPowerStateActive   = "active"
+	diskPowerStateStandby  = "standby"
+	diskPowerStateSleeping = "sleeping"
+	diskPowerStateUnknown  = "unknown"
+
+	blockDir = "/sys/block"
+)
+
+var diskPowerStates = []string{
+	diskPowerStateActive,
+	diskPowerStateStandby,
+	diskPowerStateSleeping,
+	diskPowerStateUnknown,
+}
+
+func (e *promExporter) readHdparmPath() {
+	if e.hdparm != "" {
+		return
+	}
+
+	var err error
+	e.hdparm, err = exec.LookPath("hdparm")
+	if err != nil {
+		e.Logger.Printf("Failed to find hdparm, falling back to sysfs for disk power state: %v", err)
+		return
+	}
+	e.Logger.Printf("Retrieved hdparm path: %q", e.hdparm)
+}
+
+// readDiskPowerStates reads the power state of every SATA/SAS disk without waking it up.
+// It runs before the collectors so that they can skip sleeping disks.
+func (e *promExporter) readDiskPowerStates() {
+	e.diskPowerStates = readDevicePowerStates(e.devices, e.readDiskPowerState)
+}
+
+// readDevicePowerStates reads the power state of the SATA/SAS devices concurrently, so that the scrape
+// is not delayed by one hdparm call per disk
+func readDevicePowerStates(devices []string, readState func(dev string) string) map[string]string {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	states := make(map[string]string, len(devices))
+	for _, dev := range devices {
+		if !strings.HasPrefix(dev, "sd") {
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			state := readState(dev)
+			mu.Lock()
+			states[dev] = state
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return states
+}
+
+func (e *promExporter) readDiskPowerState(dev string) string {
+	if e.hdparm != "" {
+		// ATA CHECK POWER MODE does not spin up the drive
+		output, err := utils.ExecCommand(e.hdparm, "-C", path.Join(devDir, dev))
+		if err != nil {
+			return diskPowerStateUnknown
+		}
+
+		return parseHdparmPowerState(output)
+	}
+
+	// Without hdparm, only the disks suspended by runtime power management are known to be asleep:
+	// disks spun down by hdparm or by their standby timer are still reported as active
+	runtimeStatus, err := utils.ReadFile(path.Join(blockDir, dev, "device", "power", "runtime_status"))
+	if err != nil {
+		return diskPowerStateUnknown
+	}
+
+	return parseRuntimeStatus(runtimeStatus)
+}
+
+// parseHdparmPowerState parses the output of `hdparm -C`
+func parseHdparmPowerState(output string) string {
+	for _, line := range utils.FindMatchingLines("drive state is:", output) {
+		state := strings.TrimSpace(strings.SplitN(line, ":", 2)[1])
+		switch {
+		case strings.HasPrefix(state, "active"), strings.HasPrefix(state, "idle"):
+			return diskPowerStateActive
+		case strings.HasPrefix(state, "standby"):
+			return diskPowerStateStandby
+		case strings.HasPrefix(state, "sleeping"):
+			return diskPowerStateSleeping
+		}
+	}
+
+	return diskPowerStateUnknown
+}
+
+// parseRuntimeStatus parses the runtime power management status exposed in sysfs. An active status does
+// not tell whether the disk is spinning, so it is reported as unknown.
+func parseRuntimeStatus(status string) string {
+	switch status {
+	case "suspended", "suspending":
+		return diskPowerStateStandby
+	default:
+		return diskPowerStateUnknown
+	}
+}
+
+// isDiskAsleep returns whether accessing the given device could spin it up, which is assumed
+// for the disks whose power state is unknown
+func (e *promExporter) isDiskAsleep(dev string) bool {
+	switch e.diskPowerStates[dev] {
+	case diskPowerStateStandby, diskPowerStateSleeping, diskPowerStateUnknown:
+		return true
+	default:
+		return false
+	}
+}
+
+// isSlotAsleep returns whether the disk in the given QNAP slot is asleep
+func (e *promExporter) isSlotAsleep(slot int) bool {
+	dev, ok := e.diskSlots[slot]
+	return ok && e.isDiskAsleep(dev)
+}
+
+func (e *promExporter) getDiskPowerStateMetrics() ([]metric, error) {
+	metrics := make([]metric, 0, len(e.diskPowerStates)*len(diskPowerStates))
+	for _, dev := range e.devices {
+		current, ok := e.diskPowerStates[dev]
+		if !ok {
+			continue
+		}
+
+		attr := fmt.Sprintf(`device=%q`, dev)
+		metrics = appendStateSetMetrics(metrics, "node_disk_power_state", attr, "state", diskPowerStates, current, "Power state of the disk, as reported by ATA CHECK POWER MODE")
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,98 @@
+package prometheus
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHdparmPowerState(t *testing.T) {
+	tests := map[string]string{
+		"\n/dev/sda:\n drive state is:  active/idle": diskPowerStateActive,
+		"\n/dev/sdb:\n drive state is:  idle_a":      diskPowerStateActive,
+		"\n/dev/sdc:\n drive state is:  standby":     diskPowerStateStandby,
+		"\n/dev/sdd:\n drive state is:  sleeping":    diskPowerStateSleeping,
+		"\n/dev/sde:\n drive state is:  unknown":     diskPowerStateUnknown,
+		"":                                           diskPowerStateUnknown,
+	}
+
+	for input, expected := range tests {
+		assert.Equal(t, expected, parseHdparmPowerState(input), input)
+	}
+}
+
+func TestParseRuntimeStatus(t *testing.T) {
+	assert.Equal(t, diskPowerStateUnknown, parseRuntimeStatus("active"))
+	assert.Equal(t, diskPowerStateStandby, parseRuntimeStatus("suspended"))
+	assert.Equal(t, diskPowerStateUnknown, parseRuntimeStatus("unsupported"))
+}
+
+func TestGetSysInfoHdMetricsSkipsSleepingDisks(t *testing.T) {
+	lastFetch := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	cached := metric{name: "node_hdtmp_C", attr: `hd="1",smart="GOOD"`, value: 35, timestamp: lastFetch}
+	e := &promExporter{
+		getsysinfo:      "/nonexistent/getsysinfo",
+		syshdnum:        1,
+		devices:         []string{"sda"},
+		diskSlots:       map[int]string{1: "sda"},
+		diskPowerStates: map[string]string{"sda": diskPowerStateStandby},
+		hdLastMetrics:   map[int]metric{1: cached},
+	}
+
+	metrics, err := e.getSysInfoHdMetrics()
+	require.NoError(t, err)
+	assert.Equal(t, []metric{cached}, metrics)
+	assert.Equal(t, 1, e.syshdnum)
+
+	metrics, err = e.getDiskPowerStateMetrics()
+	require.NoError(t, err)
+	require.Len(t, metrics, len(diskPowerStates))
+	assert.Equal(t, `device="sda",state="standby"`, metrics[1].attr)
+	assert.Equal(t, float64(1), metrics[1].value)
+}
+
+func TestReadDevicePowerStates(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, maxInFlight := 0, 0
+	readState := func(dev string) string {
+		mu.Lock()
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+
+		if dev == "sdb" {
+			return diskPowerStateStandby
+		}
+		return diskPowerStateActive
+	}
+
+	states := readDevicePowerStates([]string{"sda", "sdb", "sdc", "nvme0n1"}, readState)
+	assert.Equal(t, map[string]string{
+		"sda": diskPowerStateActive,
+		"sdb": diskPowerStateStandby,
+		"sdc": diskPowerStateActive,
+	}, states)
+	assert.Greater(t, maxInFlight, 1, "the disks should be queried concurrently")
+}
+
+func TestIsDiskAsleep(t *testing.T) {
+	e := &promExporter{diskPowerStates: map[string]string{
+		"sda": diskPowerStateActive,
+		"sdb": diskPowerStateStandby,
+		"sdc": diskPowerStateUnknown,
+	}}
+
+	assert.False(t, e.isDiskAsleep("sda"))
+	assert.True(t, e.isDiskAsleep("sdb"))
+	assert.True(t, e.isDiskAsleep("sdc"), "disks in an unknown state may be asleep")
+	assert.False(t, e.isDiskAsleep("nvme0n1"))
+}
@@ -0,0 +1,312 @@
+package prometheus
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pedropombeiro/qnapexporter/lib/utils"
+)
+
+// dmCacheStatus holds the fields of a dm-cache target status line, as documented in
+// https://docs.kernel.org/admin-guide/device-mapper/cache.html
+type dmCacheStatus struct {
+	device              string
+	metadataBlockSize   float64
+	metadataUsedBlocks  float64
+	metadataTotalBlocks float64
+	cacheBlockSize      float64
+	cacheUsedBlocks     float64
+	cacheTotalBlocks    float64
+	readHits            float64
+	readMisses          float64
+	writeHits           float64
+	writeMisses         float64
+	demotions           float64
+	promotions          float64
+	dirtyBlocks         float64
+	mode                string
+	policy              string
+	metadataMode        string
+	needsCheck          bool
+}
+
+// parseDmCacheStatus parses a line of `dmsetup status --target cache`:
+//
+//	<name>: <start> <length> cache <metadata block size> <#used metadata blocks>/<#total metadata blocks>
+//	<cache block size> <#used cache blocks>/<#total cache blocks> <#read hits> <#read misses>
+//	<#write hits> <#write misses> <#demotions> <#promotions> <#dirty> <#features> <features>*
+//	<#core args> <core args>* <policy name> <#policy args> <policy args>* <cache metadata mode> <needs_check>
+func parseDmCacheStatus(line string) (dmCacheStatus, error) {
+	tokens := strings.Fields(line)
+	status := dmCacheStatus{}
+	if len(tokens) > 0 && strings.HasSuffix(tokens[0], ":") {
+		status.device = strings.TrimSuffix(tokens[0], ":")
+		tokens = tokens[1:]
+	}
+	if len(tokens) < 14 || tokens[2] != "cache" {
+		return status, fmt.Errorf("unexpected dm-cache status: %q", line)
+	}
+	tokens = tokens[3:]
+
+	next := func() string {
+		if len(tokens) == 0 {
+			return ""
+		}
+		t := tokens[0]
+		tokens = tokens[1:]
+		return t
+	}
+	number := func() float64 {
+		v, _ := strconv.ParseFloat(next(), 64)
+		return v
+	}
+	skip := func() []string {
+		count, _ := strconv.Atoi(next())
+		if count > len(tokens) {
+			count = len(tokens)
+		}
+		skipped := tokens[:count]
+		tokens = tokens[count:]
+		return skipped
+	}
+
+	// Block sizes are expressed in 512-byte sectors
+	status.metadataBlockSize = number() * 512
+	status.metadataUsedBlocks, status.metadataTotalBlocks = parseUsedTotal(next())
+	status.cacheBlockSize = number() * 512
+	status.cacheUsedBlocks, status.cacheTotalBlocks = parseUsedTotal(next())
+	status.readHits = number()
+	status.readMisses = number()
+	status.writeHits = number()
+	status.writeMisses = number()
+	status.demotions = number()
+	status.promotions = number()
+	status.dirtyBlocks = number()
+
+	status.mode = "writethrough"
+	for _, feature := range skip() {
+		switch feature {
+		case "writeback", "writethrough", "passthrough":
+			status.mode = feature
+		}
+	}
+	skip() // core args
+	status.policy = next()
+	skip() // policy args
+	status.metadataMode = next()
+	status.needsCheck = next() == "needs_check"
+
+	return status, nil
+}
+
+// appendDmCacheTargetMetrics appends the status of every dm-cache target, which covers
+// all SSD cache groups regardless of their volume group name
+func (e *promExporter) appendDmCacheTargetMetrics(metrics []metric) ([]metric, error) {
+	if len(e.dmCacheTargets) == 0 {
+		return metrics, nil
+	}
+
+	lines, err := utils.ExecCommandGetLines("dmsetup", "status", "--target", "cache")
+	if errors.Is(err, exec.ErrNotFound) {
+		return metrics, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get dm-cache target status: %w", err)
+	}
+
+	kernelNames := readDmKernelNames(blockDir)
+	for _, line := range lines {
+		status, err := parseDmCacheStatus(line)
+		if err != nil {
+			// e.g. "No devices found"
+			continue
+		}
+
+		// Label the caches with their kernel name, as the QNAP hit statistics do
+		if name, ok := kernelNames[status.device]; ok {
+			status.device = name
+		}
+		metrics = append(metrics, dmCacheStatusMetrics(status, slices.Contains(e.dmCacheStatsDevices, status.device))...)
+	}
+
+	return metrics, nil
+}
+
+// parseDmTableNames returns the names of the devices listed by `dmsetup table --target cache`,
+// which prints "No devices found" when there are none
+func parseDmTableNames(lines []string) []string {
+	names := []string{}
+	for _, line := range lines {
+		tokens := strings.Fields(line)
+		if len(tokens) < 4 || !strings.HasSuffix(tokens[0], ":") || tokens[3] != "cache" {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(tokens[0], ":"))
+	}
+
+	return names
+}
+
+// readDmKernelNames maps the names of the device-mapper devices under root to their kernel names (e.g. dm-3)
+func readDmKernelNames(root string) map[string]string {
+	files, _ := filepath.Glob(path.Join(root, "dm-*", "dm", "name"))
+	names := make(map[string]string, len(files))
+	for _, f := range files {
+		name, err := utils.ReadFile(f)
+		if err != nil {
+			continue
+		}
+
+		names[name] = strings.SplitN(strings.TrimPrefix(f, root+"/"), "/", 2)[0]
+	}
+
+	return names
+}
+
+// dmCacheStatusMetrics returns the metrics of a dm-cache target. The usage and hit counters are exported
+// under the names of the QNAP SSD cache metrics, unless the cache already reports them through its
+// QNAP statistics (hasStats).
+func dmCacheStatusMetrics(s dmCacheStatus, hasStats bool) []metric {
+	attr := fmt.Sprintf("device=%q", s.device)
+	needsCheck := 0.0
+	if s.needsCheck {
+		needsCheck = 1
+	}
+
+	metrics := []metric{
+		{
+			name:       "node_dmcache_info",
+			attr:       fmt.Sprintf("%s,mode=%q,policy=%q,metadata_mode=%q", attr, s.mode, s.policy, s.metadataMode),
+			value:      1,
+			help:       "Configuration of the dm-cache target",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_dmcache_metadata_used_bytes",
+			attr:       attr,
+			value:      s.metadataUsedBlocks * s.metadataBlockSize,
+			help:       "Space used in the cache metadata device",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_dmcache_metadata_size_bytes",
+			attr:       attr,
+			value:      s.metadataTotalBlocks * s.metadataBlockSize,
+			help:       "Size of the cache metadata device",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_dmcache_dirty_bytes",
+			attr:       attr,
+			value:      s.dirtyBlocks * s.cacheBlockSize,
+			help:       "Data in the cache that has not yet been written back to the origin device",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_dmcache_demotions_total",
+			attr:       attr,
+			value:      s.demotions,
+			help:       "Number of blocks removed from the cache",
+			metricType: "counter",
+		},
+		{
+			name:       "node_dmcache_promotions_total",
+			attr:       attr,
+			value:      s.promotions,
+			help:       "Number of blocks moved into the cache",
+			metricType: "counter",
+		},
+		{
+			name:       "node_dmcache_needs_check",
+			attr:       attr,
+			value:      needsCheck,
+			help:       "Whether the cache metadata needs to be checked with cache_check",
+			metricType: "gauge",
+		},
+	}
+	if hasStats {
+		return metrics
+	}
+
+	metrics = append(
+		metrics,
+		metric{
+			name:       "node_dmcache_used_bytes_total",
+			attr:       attr,
+			value:      s.cacheUsedBlocks * s.cacheBlockSize,
+			help:       "Space used in the cache device",
+			metricType: "gauge",
+		},
+		metric{
+			name:       "node_dmcache_bytes_total",
+			attr:       attr,
+			value:      s.cacheTotalBlocks * s.cacheBlockSize,
+			help:       "Size of the cache device",
+			metricType: "gauge",
+		},
+	)
+
+	return append(metrics, dmCacheHitRatioMetrics(attr, s.readHits, s.readHits+s.readMisses, s.writeHits, s.writeHits+s.writeMisses)...)
+}
+
+// dmCacheHitRatioMetrics returns the read and write hit counters and ratios of a cache
+func dmCacheHitRatioMetrics(attr string, readHits, readTotal, writeHits, writeTotal float64) []metric {
+	metrics := []metric{
+		{
+			name:       "node_dmcache_read_hit_total",
+			attr:       attr,
+			value:      readHits,
+			help:       "Number of times a READ bio has been mapped to the cache",
+			metricType: "counter",
+		},
+		{
+			name:       "node_dmcache_read_total",
+			attr:       attr,
+			value:      readTotal,
+			help:       "Number of times a READ bio has occurred",
+			metricType: "counter",
+		},
+	}
+	if readTotal > 0 {
+		metrics = append(metrics, metric{
+			name:       "node_dmcache_read_hit_percent",
+			attr:       attr,
+			value:      readHits / readTotal * 100,
+			metricType: "counter",
+		})
+	}
+
+	metrics = append(
+		metrics,
+		metric{
+			name:       "node_dmcache_write_hit_total",
+			attr:       attr,
+			value:      writeHits,
+			help:       "Number of times a WRITE bio has been mapped to the cache",
+			metricType: "counter",
+		},
+		metric{
+			name:       "node_dmcache_write_total",
+			attr:       attr,
+			value:      writeTotal,
+			help:       "Number of times a WRITE bio has occurred",
+			metricType: "counter",
+		},
+	)
+	if writeTotal > 0 {
+		metrics = append(metrics, metric{
+			name:       "node_dmcache_write_hit_percent",
+			attr:       attr,
+			value:      writeHits / writeTotal * 100,
+			metricType: "counter",
+		})
+	}
+
+	return metrics
+}
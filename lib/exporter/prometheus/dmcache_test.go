@@ -0,0 +1,131 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDmCacheStatus(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		expected dmCacheStatus
+		wantErr  bool
+	}{
+		"writeback cache": {
+			input: "vg256-lv256: 0 1953125000 cache 8 1234/262144 2048 5000/120000 100 200 300 400 10 20 5 2 metadata2 writeback 2 migration_threshold 2048 smq 0 rw -",
+			expected: dmCacheStatus{
+				device:              "vg256-lv256",
+				metadataBlockSize:   4096,
+				metadataUsedBlocks:  1234,
+				metadataTotalBlocks: 262144,
+				cacheBlockSize:      1048576,
+				cacheUsedBlocks:     5000,
+				cacheTotalBlocks:    120000,
+				readHits:            100,
+				readMisses:          200,
+				writeHits:           300,
+				writeMisses:         400,
+				demotions:           10,
+				promotions:          20,
+				dirtyBlocks:         5,
+				mode:                "writeback",
+				policy:              "smq",
+				metadataMode:        "rw",
+			},
+		},
+		"unnamed cache needing check": {
+			input: "0 1953125000 cache 8 10/100 128 1/10 0 0 0 0 0 0 0 0 0 smq 2 migration_threshold 100 ro needs_check",
+			expected: dmCacheStatus{
+				metadataBlockSize:   4096,
+				metadataUsedBlocks:  10,
+				metadataTotalBlocks: 100,
+				cacheBlockSize:      65536,
+				cacheUsedBlocks:     1,
+				cacheTotalBlocks:    10,
+				mode:                "writethrough",
+				policy:              "smq",
+				metadataMode:        "ro",
+				needsCheck:          true,
+			},
+		},
+		"no devices": {
+			input:   "No devices found",
+			wantErr: true,
+		},
+	}
+
+	for tn, tc := range tests {
+		t.Run(tn, func(t *testing.T) {
+			status, err := parseDmCacheStatus(tc.input)
+			if tc.wantErr {
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, status)
+		})
+	}
+}
+
+func TestReadDmKernelNames(t *testing.T) {
+	root := t.TempDir()
+	writeSysfsFile(t, root, "dm-0/dm/name", "vg1-lv1\n")
+	writeSysfsFile(t, root, "dm-3/dm/name", "vg256-lv256\n")
+	writeSysfsFile(t, root, "sda/size", "0\n")
+
+	assert.Equal(t, map[string]string{"vg1-lv1": "dm-0", "vg256-lv256": "dm-3"}, readDmKernelNames(root))
+}
+
+func TestParseDmTableNames(t *testing.T) {
+	assert.Equal(t, []string{"vg1-lv1"}, parseDmTableNames([]string{
+		"vg1-lv1: 0 41943040 cache 253:2 253:1 253:3 128 2 metadata2 writethrough smq 0",
+	}))
+	assert.Empty(t, parseDmTableNames([]string{"No devices found"}))
+}
+
+func TestDmCacheStatusMetrics(t *testing.T) {
+	status := dmCacheStatus{
+		device:             "dm-3",
+		metadataBlockSize:  4096,
+		metadataUsedBlocks: 10,
+		cacheBlockSize:     65536,
+		cacheUsedBlocks:    2,
+		cacheTotalBlocks:   10,
+		readHits:           30,
+		readMisses:         10,
+		writeHits:          5,
+		mode:               "writeback",
+		policy:             "smq",
+		metadataMode:       "rw",
+	}
+
+	// Caches with QNAP statistics only report what the statistics lack, so that no series is exported twice
+	metrics := dmCacheStatusMetrics(status, true)
+	names := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		names = append(names, m.name)
+		assert.Contains(t, m.attr, `device="dm-3"`)
+	}
+	assert.Equal(t, []string{
+		"node_dmcache_info",
+		"node_dmcache_metadata_used_bytes",
+		"node_dmcache_metadata_size_bytes",
+		"node_dmcache_dirty_bytes",
+		"node_dmcache_demotions_total",
+		"node_dmcache_promotions_total",
+		"node_dmcache_needs_check",
+	}, names)
+
+	metrics = dmCacheStatusMetrics(status, false)
+	require.Len(t, metrics, len(names)+8)
+	assert.Equal(t, metric{name: "node_dmcache_used_bytes_total", attr: `device="dm-3"`, value: 131072, help: "Space used in the cache device", metricType: "gauge"}, metrics[7])
+	assert.Equal(t, "node_dmcache_read_total", metrics[10].name)
+	assert.Equal(t, 40.0, metrics[10].value)
+	assert.Equal(t, "node_dmcache_read_hit_percent", metrics[11].name)
+	assert.Equal(t, 75.0, metrics[11].value)
+	assert.Equal(t, "node_dmcache_write_hit_percent", metrics[14].name)
+	assert.Equal(t, 100.0, metrics[14].value)
+}
@@ -0,0 +1,302 @@
+package prometheus
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/moby/moby/api/types/container"
+	"github.com/moby/moby/client"
+)
+
+const (
+	dockerTimeout = 10 * time.Second
+
+	composeProjectLabel = "com.docker.compose.project"
+)
+
+var (
+	dockerContainerStates = []string{
+		string(container.StateCreated),
+		string(container.StateRunning),
+		string(container.StatePaused),
+		string(container.StateRestarting),
+		string(container.StateRemoving),
+		string(container.StateExited),
+		string(container.StateDead),
+	}
+	dockerHealthStatuses = []string{
+		string(container.NoHealthcheck),
+		string(container.Starting),
+		string(container.Healthy),
+		string(container.Unhealthy),
+	}
+)
+
+// dockerContainer holds what the Docker daemon reports about a container. stats is only set for running containers.
+type dockerContainer struct {
+	summary container.Summary
+	inspect container.InspectResponse
+	stats   *container.StatsResponse
+}
+
+func (e *promExporter) readDockerClient() {
+	if e.docker != nil {
+		return
+	}
+
+	var err error
+	e.docker, err = client.New()
+	if err != nil {
+		e.Logger.Printf("Failed to create Docker client: %v", err)
+	}
+}
+
+func (e *promExporter) getDockerMetrics() ([]metric, error) {
+	if e.docker == nil {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dockerTimeout)
+	defer cancel()
+
+	list, err := e.docker.ContainerList(ctx, client.ContainerListOptions{All: true})
+	if err != nil {
+		if client.IsErrConnectionFailed(err) {
+			// Ignore if Docker (or Container Station) is not running
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("list Docker containers: %w", err)
+	}
+
+	now := time.Now()
+	metrics := make([]metric, 0, len(list.Items)*(len(dockerContainerStates)+len(dockerHealthStatuses)+10))
+	for _, summary := range list.Items {
+		c, err := e.readDockerContainer(ctx, summary)
+		if err != nil {
+			// The container may have been removed since it was listed
+			e.Logger.Println(err.Error())
+			continue
+		}
+
+		metrics = append(metrics, dockerContainerMetrics(c, now)...)
+	}
+
+	return metrics, nil
+}
+
+func (e *promExporter) readDockerContainer(ctx context.Context, summary container.Summary) (dockerContainer, error) {
+	c := dockerContainer{summary: summary}
+
+	inspect, err := e.docker.ContainerInspect(ctx, summary.ID, client.ContainerInspectOptions{})
+	if err != nil {
+		return c, fmt.Errorf("inspect Docker container %s: %w", summary.ID, err)
+	}
+	c.inspect = inspect.Container
+
+	if summary.State != container.StateRunning {
+		return c, nil
+	}
+
+	result, err := e.docker.ContainerStats(ctx, summary.ID, client.ContainerStatsOptions{})
+	if err != nil {
+		return c, fmt.Errorf("get stats of Docker container %s: %w", summary.ID, err)
+	}
+	defer func() { _ = result.Body.Close() }()
+
+	var stats container.StatsResponse
+	if err := json.NewDecoder(result.Body).Decode(&stats); err != nil {
+		return c, fmt.Errorf("decode stats of Docker container %s: %w", summary.ID, err)
+	}
+	c.stats = &stats
+
+	return c, nil
+}
+
+func dockerContainerMetrics(c dockerContainer, now time.Time) []metric {
+	name := c.inspect.Name
+	if name == "" && len(c.summary.Names) > 0 {
+		name = c.summary.Names[0]
+	}
+	attr := fmt.Sprintf("name=%q,image=%q,compose_project=%q",
+		strings.TrimPrefix(name, "/"), c.summary.Image, c.summary.Labels[composeProjectLabel])
+
+	health := string(container.NoHealthcheck)
+	if c.inspect.State != nil && c.inspect.State.Health != nil {
+		health = string(c.inspect.State.Health.Status)
+	}
+
+	var uptime float64
+	if c.inspect.State != nil && c.inspect.State.Running {
+		if startedAt, err := time.Parse(time.RFC3339Nano, c.inspect.State.StartedAt); err == nil {
+			uptime = now.Sub(startedAt).Seconds()
+		}
+	}
+
+	metrics := appendStateSetMetrics(nil, "node_docker_container_state", attr, "state", dockerContainerStates, string(c.summary.State), "State of the Docker container")
+	metrics = appendStateSetMetrics(metrics, "node_docker_container_health_status", attr, "status", dockerHealthStatuses, health, "Health check status of the Docker container")
+	metrics = append(
+		metrics,
+		metric{
+			name:       "node_docker_container_restart_count",
+			attr:       attr,
+			value:      float64(c.inspect.RestartCount),
+			help:       "Number of times the Docker daemon restarted the container",
+			metricType: "gauge",
+		},
+		metric{
+			name:       "node_docker_container_uptime_seconds",
+			attr:       attr,
+			value:      uptime,
+			help:       "Time since the Docker container was started (0 if not running)",
+			metricType: "gauge",
+		},
+	)
+	if c.stats == nil {
+		return metrics
+	}
+
+	s := c.stats
+	// As `docker stats`, do not count the inactive page cache as used memory
+	memoryUsage := s.MemoryStats.Usage
+	if inactive, ok := s.MemoryStats.Stats["inactive_file"]; ok && inactive < memoryUsage {
+		memoryUsage -= inactive
+	}
+
+	var rxBytes, txBytes float64
+	for _, n := range s.Networks {
+		rxBytes += float64(n.RxBytes)
+		txBytes += float64(n.TxBytes)
+	}
+
+	var readBytes, writtenBytes float64
+	for _, entry := range s.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			readBytes += float64(entry.Value)
+		case "write":
+			writtenBytes += float64(entry.Value)
+		}
+	}
+
+	return append(
+		metrics,
+		metric{
+			name:       "node_docker_container_cpu_seconds_total",
+			attr:       attr,
+			value:      float64(s.CPUStats.CPUUsage.TotalUsage) / float64(time.Second),
+			help:       "CPU time spent by the Docker container",
+			metricType: "counter",
+		},
+		metric{
+			name:       "node_docker_container_memory_usage_bytes",
+			attr:       attr,
+			value:      float64(memoryUsage),
+			help:       "Memory used by the Docker container, excluding the inactive page cache",
+			metricType: "gauge",
+		},
+		metric{
+			name:       "node_docker_container_memory_limit_bytes",
+			attr:       attr,
+			value:      float64(s.MemoryStats.Limit),
+			help:       "Memory limit of the Docker container",
+			metricType: "gauge",
+		},
+		metric{
+			name:       "node_docker_container_network_receive_bytes_total",
+			attr:       attr,
+			value:      rxBytes,
+			help:       "Number of bytes received by the Docker container",
+			metricType: "counter",
+		},
+		metric{
+			name:       "node_docker_container_network_transmit_bytes_total",
+			attr:       attr,
+			value:      txBytes,
+			help:       "Number of bytes transmitted by the Docker container",
+			metricType: "counter",
+		},
+		metric{
+			name:       "node_docker_container_block_read_bytes_total",
+			attr:       attr,
+			value:      readBytes,
+			help:       "Number of bytes read from block devices by the Docker container",
+			metricType: "counter",
+		},
+		metric{
+			name:       "node_docker_container_block_written_bytes_total",
+			attr:       attr,
+			value:      writtenBytes,
+			help:       "Number of bytes written to block devices by the Docker container",
+			metricType: "counter",
+		},
+	)
+}
+
+// DockerEventCounter counts the events received from the Docker daemon, to export them as counters
+type DockerEventCounter struct {
+	mu sync.Mutex
+	// counts is keyed by event type, action and container name
+	counts map[[3]string]float64
+}
+
+// NewDockerEventCounter returns an empty DockerEventCounter
+func NewDockerEventCounter() *DockerEventCounter {
+	return &DockerEventCounter{counts: make(map[[3]string]float64)}
+}
+
+// Inc counts an event of the given type and action, about the named container (empty for other objects).
+// The counts of a destroyed container are moved to the empty container label, so that the one-off containers
+// do not leave their series behind while the totals per type and action keep increasing.
+func (c *DockerEventCounter) Inc(eventType, action, container string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if eventType != "container" || action != "destroy" || container == "" {
+		c.counts[[3]string{eventType, action, container}]++
+		return
+	}
+
+	for key, count := range c.counts {
+		if key[2] == container {
+			c.counts[[3]string{key[0], key[1], ""}] += count
+			delete(c.counts, key)
+		}
+	}
+	c.counts[[3]string{eventType, action, ""}]++
+}
+
+func (e *promExporter) getDockerEventMetrics() ([]metric, error) {
+	if e.DockerEvents == nil {
+		return nil, nil
+	}
+
+	return e.DockerEvents.metrics(), nil
+}
+
+func (c *DockerEventCounter) metrics() []metric {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := slices.SortedFunc(maps.Keys(c.counts), func(a, b [3]string) int {
+		return slices.Compare(a[:], b[:])
+	})
+	metrics := make([]metric, 0, len(keys))
+	for _, key := range keys {
+		metrics = append(metrics, metric{
+			name:       "docker_events_total",
+			attr:       fmt.Sprintf("type=%q,action=%q,container=%q", key[0], key[1], key[2]),
+			value:      c.counts[key],
+			help:       "Number of events received from the Docker daemon",
+			metricType: "counter",
+		})
+	}
+
+	return metrics
+}
@@ -0,0 +1,133 @@
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/moby/moby/api/types/container"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func findMetric(metrics []metric, name, attr string) (metric, bool) {
+	for _, m := range metrics {
+		if m.name == name && m.attr == attr {
+			return m, true
+		}
+	}
+
+	return metric{}, false
+}
+
+func TestDockerContainerMetrics(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	const attr = `name="plex",image="plexinc/pms-docker:latest",compose_project="media"`
+
+	metrics := dockerContainerMetrics(dockerContainer{
+		summary: container.Summary{
+			ID:     "0123456789ab",
+			Names:  []string{"/plex"},
+			Image:  "plexinc/pms-docker:latest",
+			State:  container.StateRunning,
+			Labels: map[string]string{composeProjectLabel: "media"},
+		},
+		inspect: container.InspectResponse{
+			Name:         "/plex",
+			RestartCount: 2,
+			State: &container.State{
+				Status:    container.StateRunning,
+				Running:   true,
+				StartedAt: "2026-10-19T11:00:00.123456789Z",
+				Health:    &container.Health{Status: container.Healthy},
+			},
+		},
+		stats: &container.StatsResponse{
+			CPUStats: container.CPUStats{CPUUsage: container.CPUUsage{TotalUsage: 12_500_000_000}},
+			MemoryStats: container.MemoryStats{
+				Usage: 300,
+				Limit: 1000,
+				Stats: map[string]uint64{"inactive_file": 100},
+			},
+			Networks: map[string]container.NetworkStats{
+				"eth0": {RxBytes: 10, TxBytes: 20},
+				"eth1": {RxBytes: 1, TxBytes: 2},
+			},
+			BlkioStats: container.BlkioStats{IoServiceBytesRecursive: []container.BlkioStatEntry{
+				{Major: 8, Op: "read", Value: 4096},
+				{Major: 8, Op: "write", Value: 8192},
+				{Major: 9, Op: "Read", Value: 1024},
+			}},
+		},
+	}, now)
+
+	expected := map[string]float64{
+		"node_docker_container_restart_count":                2,
+		"node_docker_container_uptime_seconds":               now.Sub(time.Date(2026, 10, 19, 11, 0, 0, 123456789, time.UTC)).Seconds(),
+		"node_docker_container_cpu_seconds_total":            12.5,
+		"node_docker_container_memory_usage_bytes":           200,
+		"node_docker_container_memory_limit_bytes":           1000,
+		"node_docker_container_network_receive_bytes_total":  11,
+		"node_docker_container_network_transmit_bytes_total": 22,
+		"node_docker_container_block_read_bytes_total":       5120,
+		"node_docker_container_block_written_bytes_total":    8192,
+	}
+	for name, value := range expected {
+		m, ok := findMetric(metrics, name, attr)
+		require.True(t, ok, name)
+		assert.Equal(t, value, m.value, name)
+	}
+
+	m, ok := findMetric(metrics, "node_docker_container_state", attr+`,state="running"`)
+	require.True(t, ok)
+	assert.Equal(t, 1.0, m.value)
+	m, ok = findMetric(metrics, "node_docker_container_health_status", attr+`,status="healthy"`)
+	require.True(t, ok)
+	assert.Equal(t, 1.0, m.value)
+}
+
+func TestDockerContainerMetricsStopped(t *testing.T) {
+	metrics := dockerContainerMetrics(dockerContainer{
+		summary: container.Summary{Names: []string{"/backup"}, Image: "restic/restic", State: container.StateExited},
+		inspect: container.InspectResponse{State: &container.State{Status: container.StateExited, StartedAt: "2026-10-19T11:00:00Z"}},
+	}, time.Now())
+
+	const attr = `name="backup",image="restic/restic",compose_project=""`
+	assert.Len(t, metrics, len(dockerContainerStates)+len(dockerHealthStatuses)+2)
+
+	m, ok := findMetric(metrics, "node_docker_container_state", attr+`,state="exited"`)
+	require.True(t, ok)
+	assert.Equal(t, 1.0, m.value)
+	m, ok = findMetric(metrics, "node_docker_container_health_status", attr+`,status="none"`)
+	require.True(t, ok)
+	assert.Equal(t, 1.0, m.value)
+	m, ok = findMetric(metrics, "node_docker_container_uptime_seconds", attr)
+	require.True(t, ok)
+	assert.Zero(t, m.value)
+}
+
+func TestDockerEventCounter(t *testing.T) {
+	c := NewDockerEventCounter()
+	c.Inc("container", "start", "plex")
+	c.Inc("image", "delete", "")
+	c.Inc("container", "start", "plex")
+	c.Inc("container", "die", "plex")
+
+	assert.Equal(t, []metric{
+		{name: "docker_events_total", attr: `type="container",action="die",container="plex"`, value: 1, help: "Number of events received from the Docker daemon", metricType: "counter"},
+		{name: "docker_events_total", attr: `type="container",action="start",container="plex"`, value: 2, help: "Number of events received from the Docker daemon", metricType: "counter"},
+		{name: "docker_events_total", attr: `type="image",action="delete",container=""`, value: 1, help: "Number of events received from the Docker daemon", metricType: "counter"},
+	}, c.metrics())
+
+	// The counts of destroyed containers are kept without their container label
+	c.Inc("container", "start", "backup")
+	c.Inc("container", "destroy", "backup")
+	c.Inc("container", "start", "backup")
+	c.Inc("container", "destroy", "backup")
+
+	metrics := c.metrics()
+	require.Len(t, metrics, 5)
+	assert.Equal(t, `type="container",action="destroy",container=""`, metrics[0].attr)
+	assert.Equal(t, 2.0, metrics[0].value)
+	assert.Equal(t, `type="container",action="start",container=""`, metrics[2].attr)
+	assert.Equal(t, 2.0, metrics[2].value)
+}
@@ -0,0 +1,209 @@
+package prometheus
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pedropombeiro/qnapexporter/lib/utils"
+)
+
+var (
+	enclosureTempRe = regexp.MustCompile(`(?m)temp(?:erature)?\s*=\s*(-?[\d.]+)`)
+
+	// enclosureFanStates lists the states exported for each enclosure fan
+	enclosureFanStates = []string{"ok", "failed", "unknown"}
+)
+
+// fanStatus holds the state of an enclosure fan as reported by `hal_app --se_sys_get_fan`
+type fanStatus struct {
+	state  string
+	speed  float64
+	hasRPM bool
+}
+
+// parseFanStatus parses the output of `hal_app --se_sys_get_fan`. The fan is only reported as failed
+// when hal_app flags a fault, as fans can be stopped on purpose in the quiet fan modes.
+func parseFanStatus(output string) fanStatus {
+	values := parseHalAppValues(output)
+	fan := fanStatus{state: "unknown"}
+
+	if matches := fanRpmRe.FindStringSubmatch(output); len(matches) == 2 {
+		if v, err := strconv.ParseFloat(matches[1], 64); err == nil {
+			fan.speed = v
+			fan.hasRPM = true
+		}
+	}
+
+	state, known := parseHalAppStatus(values["status"])
+	switch {
+	case values["fault"] == "1":
+		fan.state = "failed"
+	case known && slices.Contains(enclosureFanStates, state):
+		fan.state = state
+	case values["status"] == "" && fan.hasRPM:
+		fan.state = "ok"
+	}
+
+	return fan
+}
+
+// readFanStatus returns the status of the fan with the given index in the enclosure, or an unknown
+// status if hal_app is not available or fails
+func (e *promExporter) readFanStatus(encID string, fanIdx int) fanStatus {
+	if e.halApp == "" {
+		return fanStatus{state: "unknown"}
+	}
+
+	output, err := utils.ExecCommand(e.halApp, "--se_sys_get_fan", fmt.Sprintf("enc_sys_id=%s,obj_index=%d", encID, fanIdx))
+	if err != nil {
+		return fanStatus{state: "unknown"}
+	}
+
+	return parseFanStatus(output)
+}
+
+// parseSeEnum parses the output of `hal_app --se_enum`, returning the NAS chassis (enc_sys_id=root)
+// followed by the expansion enclosures (QM2 cards, TR and TL series units)
+func parseSeEnum(output string) []qnapEnclosure {
+	var enclosures []qnapEnclosure
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 11 {
+			continue
+		}
+
+		enc := qnapEnclosure{
+			id:        fields[2],
+			name:      fields[4],
+			connected: true,
+		}
+		var err error
+		if enc.diskCount, err = strconv.Atoi(fields[7]); err != nil {
+			// Header line
+			continue
+		}
+		enc.fanCount, _ = strconv.Atoi(fields[8])
+		enc.psuCount, _ = strconv.Atoi(fields[9])
+		enc.tempCount, _ = strconv.Atoi(fields[10])
+		enclosures = append(enclosures, enc)
+	}
+
+	return enclosures
+}
+
+func (e *promExporter) getEnclosureMetrics() ([]metric, error) {
+	if e.halApp == "" {
+		return nil, nil
+	}
+
+	metrics := make([]metric, 0, len(e.enclosures)*8)
+	for _, enc := range e.enclosures {
+		metrics = append(metrics, enclosureMetrics(enc)...)
+		if !enc.connected {
+			continue
+		}
+
+		var err error
+		metrics, err = e.appendEnclosureTempMetrics(metrics, enc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return metrics, nil
+}
+
+// appendEnclosureTempMetrics appends the readings of the temperature sensors of an enclosure
+func (e *promExporter) appendEnclosureTempMetrics(metrics []metric, enc qnapEnclosure) ([]metric, error) {
+	for tempNum := 0; tempNum < enc.tempCount; tempNum++ {
+		tempOutput, err := utils.ExecCommand(e.halApp, "--se_sys_get_temp", fmt.Sprintf("enc_sys_id=%s,obj_index=%d", enc.id, tempNum))
+		if err != nil {
+			return nil, err
+		}
+
+		temp, ok := parseEnclosureTemp(tempOutput)
+		if !ok {
+			continue
+		}
+		metrics = append(metrics, metric{
+			name:       "node_enclosure_temperature_celsius",
+			attr:       fmt.Sprintf(`enclosure=%q,sensor="%d"`, enc.id, 1+tempNum),
+			value:      temp,
+			help:       "Temperature reported by the enclosure sensors",
+			metricType: "gauge",
+		})
+	}
+
+	return metrics, nil
+}
+
+func enclosureMetrics(enc qnapEnclosure) []metric {
+	attr := fmt.Sprintf("enclosure=%q", enc.id)
+	connected := 0.0
+	if enc.connected {
+		connected = 1
+	}
+
+	metrics := []metric{
+		{
+			name:       "node_enclosure_info",
+			attr:       fmt.Sprintf("%s,model=%q", attr, enc.name),
+			value:      1,
+			help:       "Model of the expansion enclosure",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_enclosure_connected",
+			attr:       attr,
+			value:      connected,
+			help:       "Whether the expansion enclosure is connected",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_enclosure_disk_slots",
+			attr:       attr,
+			value:      float64(enc.diskCount),
+			help:       "Number of disk slots in the expansion enclosure",
+			metricType: "gauge",
+		},
+	}
+
+	if !enc.connected {
+		return metrics
+	}
+
+	for slot := 1; slot <= enc.diskCount; slot++ {
+		occupied := 0.0
+		if _, ok := enc.disks[slot]; ok {
+			occupied = 1
+		}
+
+		metrics = append(metrics, metric{
+			name:       "node_enclosure_disk_slot_occupied",
+			attr:       fmt.Sprintf(`%s,slot="%d"`, attr, slot),
+			value:      occupied,
+			help:       "Whether a disk is installed in the enclosure slot",
+			metricType: "gauge",
+		})
+	}
+
+	return metrics
+}
+
+// parseEnclosureTemp parses the output of `hal_app --se_sys_get_temp`
+func parseEnclosureTemp(output string) (float64, bool) {
+	matches := enclosureTempRe.FindStringSubmatch(output)
+	if len(matches) < 2 {
+		return 0, false
+	}
+
+	temp, err := strconv.ParseFloat(matches[1], 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return temp, true
+}
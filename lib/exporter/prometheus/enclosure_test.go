@@ -0,0 +1,118 @@
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSeEnum(t *testing.T) {
+	enclosures := parseSeEnum(`enc_id enc_type enc_sys_id sub_id model      vendor serial   max_disk max_fan max_psu max_temp
+0      1        root       0      TS-453D    QNAP   Q200A001 4        1       1       2
+1      4        qm2_1_1    0      QM2-2P-344 QNAP   Q200B002 2        1       0       1
+2      3        tr004_1    0      TR-004     QNAP   Q200C003 4        1       1       1
+`)
+
+	require.Len(t, enclosures, 3)
+	assert.Equal(t, qnapEnclosure{id: "root", name: "TS-453D", diskCount: 4, fanCount: 1, psuCount: 1, tempCount: 2, connected: true}, enclosures[0])
+	assert.Equal(t, qnapEnclosure{id: "qm2_1_1", name: "QM2-2P-344", diskCount: 2, fanCount: 1, tempCount: 1, connected: true}, enclosures[1])
+	assert.Equal(t, qnapEnclosure{id: "tr004_1", name: "TR-004", diskCount: 4, fanCount: 1, psuCount: 1, tempCount: 1, connected: true}, enclosures[2])
+}
+
+func TestParseEnclosureTemp(t *testing.T) {
+	temp, ok := parseEnclosureTemp("enc_sys_id = tr004_1\nobj_index = 0\ntemp = 38 C\n")
+	assert.True(t, ok)
+	assert.Equal(t, 38.0, temp)
+
+	_, ok = parseEnclosureTemp("error: object not found")
+	assert.False(t, ok)
+}
+
+func TestEnclosureMetrics(t *testing.T) {
+	metrics := enclosureMetrics(qnapEnclosure{
+		id:        "tr004_1",
+		name:      "TR-004",
+		diskCount: 2,
+		connected: true,
+		disks:     map[int]string{2: "sdf"},
+	})
+
+	assert.Equal(t, []metric{
+		{name: "node_enclosure_info", attr: `enclosure="tr004_1",model="TR-004"`, value: 1, help: "Model of the expansion enclosure", metricType: "gauge"},
+		{name: "node_enclosure_connected", attr: `enclosure="tr004_1"`, value: 1, help: "Whether the expansion enclosure is connected", metricType: "gauge"},
+		{name: "node_enclosure_disk_slots", attr: `enclosure="tr004_1"`, value: 2, help: "Number of disk slots in the expansion enclosure", metricType: "gauge"},
+		{name: "node_enclosure_disk_slot_occupied", attr: `enclosure="tr004_1",slot="1"`, value: 0, help: "Whether a disk is installed in the enclosure slot", metricType: "gauge"},
+		{name: "node_enclosure_disk_slot_occupied", attr: `enclosure="tr004_1",slot="2"`, value: 1, help: "Whether a disk is installed in the enclosure slot", metricType: "gauge"},
+	}, metrics)
+
+	metrics = enclosureMetrics(qnapEnclosure{id: "tr004_1", name: "TR-004", diskCount: 2})
+	require.Len(t, metrics, 3)
+	assert.Zero(t, metrics[1].value)
+}
+
+func TestParseFanStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   fanStatus
+	}{
+		{
+			name:   "spinning",
+			output: "enc_sys_id = root\nobj_index = 0\nfan = 1234 rpm\n",
+			want:   fanStatus{state: "ok", speed: 1234, hasRPM: true},
+		},
+		{
+			name:   "stopped in quiet mode",
+			output: "fan = 0 rpm\nstatus = OK\n",
+			want:   fanStatus{state: "ok", speed: 0, hasRPM: true},
+		},
+		{
+			name:   "faulty",
+			output: "fan = 0 rpm\nfault = 1\n",
+			want:   fanStatus{state: "failed", speed: 0, hasRPM: true},
+		},
+		{
+			name:   "failed status",
+			output: "status = Fail\n",
+			want:   fanStatus{state: "failed"},
+		},
+		{
+			name:   "not ok",
+			output: "fan = 0 rpm\nstatus = Not OK\n",
+			want:   fanStatus{state: "failed", speed: 0, hasRPM: true},
+		},
+		{
+			name:   "broken",
+			output: "status = broken\n",
+			want:   fanStatus{state: "failed"},
+		},
+		{
+			name:   "unparsable",
+			output: "error: invalid object",
+			want:   fanStatus{state: "unknown"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseFanStatus(tt.output))
+		})
+	}
+}
+
+func TestReadRootFanStatesIsCached(t *testing.T) {
+	e := &promExporter{
+		halApp:  "/nonexistent/hal_app",
+		chassis: qnapEnclosure{id: "root", fanCount: 2},
+	}
+
+	assert.Equal(t, []string{"unknown", "unknown"}, e.readRootFanStates())
+
+	e.rootFanStates = []string{"ok", "failed"}
+	assert.Equal(t, []string{"ok", "failed"}, e.readRootFanStates())
+
+	e.rootFanStatesExpiry = time.Now().Add(-time.Second)
+	assert.Equal(t, []string{"unknown", "unknown"}, e.readRootFanStates())
+}
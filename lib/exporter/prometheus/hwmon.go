@@ -0,0 +1,299 @@
+package prometheus
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pedropombeiro/qnapexporter/lib/utils"
+)
+
+const (
+	hwmonDir   = "/sys/class/hwmon"
+	thermalDir = "/sys/class/thermal"
+)
+
+// hwmonSensorTypes lists the hwmon sensor types exported by the fallback sensor collector
+var hwmonSensorTypes = []struct {
+	prefix string
+	name   string
+	scale  float64
+	help   string
+}{
+	{prefix: "temp", name: "node_hwmon_temp_celsius", scale: 0.001, help: "Temperature reported by the hardware monitor"},
+	{prefix: "fan", name: "node_hwmon_fan_rpm", scale: 1, help: "Fan speed reported by the hardware monitor"},
+	{prefix: "in", name: "node_hwmon_in_volts", scale: 0.001, help: "Voltage reported by the hardware monitor"},
+}
+
+// hwmonChip is a hardware monitoring chip exposed in /sys/class/hwmon
+type hwmonChip struct {
+	dir    string
+	name   string
+	device string
+	// inputs holds the sensor readings, keyed by sensor name (e.g. "temp1")
+	inputs map[string]float64
+}
+
+func (c hwmonChip) attr() string {
+	return fmt.Sprintf("chip=%q,device=%q", c.name, c.device)
+}
+
+// sensors returns the readings of the sensors of the given type (e.g. "temp")
+func (c hwmonChip) sensors(prefix string) map[string]float64 {
+	values := make(map[string]float64)
+	for sensor, v := range c.inputs {
+		if idx, ok := strings.CutPrefix(sensor, prefix); ok {
+			if _, err := strconv.Atoi(idx); err == nil {
+				values[sensor] = v
+			}
+		}
+	}
+
+	return values
+}
+
+// readHwmonChips lists the hwmon chips under root, identified by their driver name and the
+// device they are bound to, which are stable across reboots unlike the hwmon* numbering
+func readHwmonChips(root string) []hwmonChip {
+	entries, _ := os.ReadDir(root)
+	chips := make([]hwmonChip, 0, len(entries))
+	for _, entry := range entries {
+		dir := path.Join(root, entry.Name())
+		name, err := utils.ReadFile(path.Join(dir, "name"))
+		if err != nil {
+			continue
+		}
+
+		chip := hwmonChip{dir: dir, name: name}
+		if target, err := os.Readlink(path.Join(dir, "device")); err == nil {
+			chip.device = path.Base(target)
+		}
+		if name == "drivetemp" {
+			// Report disk temperatures against the block device rather than the SCSI address
+			if blocks, _ := filepath.Glob(path.Join(dir, "device", "block", "*")); len(blocks) > 0 {
+				chip.device = path.Base(blocks[0])
+			}
+		}
+		chips = append(chips, chip)
+	}
+
+	return chips
+}
+
+// readHwmonValues reads the sensor attributes of a chip matching the given glob pattern
+// (e.g. "fan*_alarm"), keyed by the sensor name (e.g. "fan1")
+func readHwmonValues(chip hwmonChip, pattern string) map[string]float64 {
+	files, _ := filepath.Glob(path.Join(chip.dir, pattern))
+	values := make(map[string]float64, len(files))
+	for _, file := range files {
+		s, err := utils.ReadFile(file)
+		if err != nil {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			continue
+		}
+
+		sensor, _, _ := strings.Cut(path.Base(file), "_")
+		values[sensor] = v
+	}
+
+	return values
+}
+
+// appendHwmonFaultMetrics appends the fan fault flags and chassis intrusion detection
+// switches reported by the hwmon chips under root
+func appendHwmonFaultMetrics(metrics []metric, root string) []metric {
+	for _, chip := range readHwmonChips(root) {
+		faults := readHwmonValues(chip, "fan*_alarm")
+		for sensor, v := range readHwmonValues(chip, "fan*_fault") {
+			faults[sensor] = max(faults[sensor], v)
+		}
+		for _, sensor := range sortedSensors(faults) {
+			metrics = append(metrics, metric{
+				name:       "node_hwmon_fan_fault",
+				attr:       fmt.Sprintf("%s,sensor=%q", chip.attr(), sensor),
+				value:      faults[sensor],
+				help:       "Whether the hardware monitor reports a fan alarm or fault",
+				metricType: "gauge",
+			})
+		}
+
+		intrusions := readHwmonValues(chip, "intrusion*_alarm")
+		for _, sensor := range sortedSensors(intrusions) {
+			metrics = append(metrics, metric{
+				name:       "node_chassis_intrusion",
+				attr:       fmt.Sprintf("%s,sensor=%q", chip.attr(), sensor),
+				value:      intrusions[sensor],
+				help:       "Whether the chassis intrusion detection switch was triggered",
+				metricType: "gauge",
+			})
+		}
+	}
+
+	return metrics
+}
+
+// getHwmonSensorMetrics reports the hwmon and thermal zone sensors, as a fallback for
+// models or containers where the QNAP getsysinfo tool is not available
+func (e *promExporter) getHwmonSensorMetrics() ([]metric, error) {
+	if e.getsysinfo != "" {
+		return nil, nil
+	}
+
+	metrics := appendHwmonSensorMetrics(nil, e.hwmonChips)
+	return appendThermalZoneMetrics(metrics, thermalDir), nil
+}
+
+// getHwmonSysInfoMetrics reports the hwmon sensors under the getsysinfo metric names on generic Linux hosts.
+// It is separate from getHwmonSensorMetrics, so that skipping the host metrics keeps the metrics that the
+// QNAP dashboards need.
+func (e *promExporter) getHwmonSysInfoMetrics() ([]metric, error) {
+	if !e.genericLinux {
+		return nil, nil
+	}
+
+	return appendHwmonSysInfoMetrics(nil, e.hwmonChips, e.diskSlots), nil
+}
+
+// appendHwmonSysInfoMetrics appends the readings of the given hwmon chips under the metric names
+// reported by getsysinfo on QTS, so that the same dashboards work on generic Linux hosts.
+// The disk temperatures are numbered by the slots in diskSlots, as `getsysinfo hdtmp` does.
+func appendHwmonSysInfoMetrics(metrics []metric, chips []hwmonChip, diskSlots map[int]string) []metric {
+	cpuTemp := math.NaN()
+	fanNum := 0
+	for _, chip := range chips {
+		switch chip.name {
+		case "coretemp", "k10temp", "zenpower", "cpu_thermal":
+			for _, temp := range chip.sensors("temp") {
+				if math.IsNaN(cpuTemp) || temp/1000 > cpuTemp {
+					cpuTemp = temp / 1000
+				}
+			}
+		case "drivetemp":
+			temp, ok := chip.inputs["temp1"]
+			hd, found := diskSlot(diskSlots, chip.device)
+			if !ok || !found {
+				continue
+			}
+
+			metrics = append(metrics, metric{
+				name:  "node_hdtmp_C",
+				attr:  fmt.Sprintf(`hd="%d",device=%q`, hd, chip.device),
+				value: temp / 1000,
+			})
+		default:
+			fans := chip.sensors("fan")
+			for _, sensor := range sortedSensors(fans) {
+				fanNum++
+				metrics = append(metrics, metric{
+					name:  "node_sysfan_RPM",
+					attr:  fmt.Sprintf(`fan="%d",type="System"`, fanNum),
+					value: fans[sensor],
+				})
+			}
+		}
+	}
+
+	if !math.IsNaN(cpuTemp) {
+		metrics = append(metrics, metric{
+			name:  "node_cputmp_C",
+			value: cpuTemp,
+		})
+	}
+
+	return metrics
+}
+
+// readAwakeHwmonChips lists the hwmon chips under root along with their sensor readings, skipping the drivetemp chips of the
+// sleeping disks, as the SMART commands sent to read their temperature would spin them up
+func (e *promExporter) readAwakeHwmonChips(root string) []hwmonChip {
+	chips := readHwmonChips(root)
+	awake := chips[:0]
+	for _, chip := range chips {
+		if chip.name == "drivetemp" && e.isDiskAsleep(chip.device) {
+			continue
+		}
+		chip.inputs = readHwmonValues(chip, "*_input")
+		awake = append(awake, chip)
+	}
+
+	return awake
+}
+
+// appendHwmonSensorMetrics appends the temperatures, fan speeds and voltages reported by
+// the given hwmon chips, including disk temperatures from the drivetemp module
+func appendHwmonSensorMetrics(metrics []metric, chips []hwmonChip) []metric {
+	for _, chip := range chips {
+		for _, t := range hwmonSensorTypes {
+			values := chip.sensors(t.prefix)
+			for _, sensor := range sortedSensors(values) {
+				label, _ := utils.ReadFile(path.Join(chip.dir, sensor+"_label"))
+				metrics = append(metrics, metric{
+					name:       t.name,
+					attr:       fmt.Sprintf("%s,sensor=%q,label=%q", chip.attr(), sensor, label),
+					value:      values[sensor] * t.scale,
+					help:       t.help,
+					metricType: "gauge",
+				})
+			}
+		}
+	}
+
+	return metrics
+}
+
+// appendThermalZoneMetrics appends the temperatures of the ACPI/platform thermal zones under root
+func appendThermalZoneMetrics(metrics []metric, root string) []metric {
+	zones, _ := filepath.Glob(path.Join(root, "thermal_zone*"))
+	sort.Strings(zones)
+	for _, zone := range zones {
+		temp, err := utils.ReadFile(path.Join(zone, "temp"))
+		if err != nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(temp, 64)
+		if err != nil {
+			continue
+		}
+
+		zoneType, _ := utils.ReadFile(path.Join(zone, "type"))
+		metrics = append(metrics, metric{
+			name:       "node_thermal_zone_temp",
+			attr:       fmt.Sprintf("zone=%q,type=%q", strings.TrimPrefix(path.Base(zone), "thermal_zone"), zoneType),
+			value:      value / 1000,
+			help:       "Temperature of the thermal zone in degrees Celsius",
+			metricType: "gauge",
+		})
+	}
+
+	return metrics
+}
+
+// diskSlot returns the slot of the given disk device
+func diskSlot(diskSlots map[int]string, dev string) (int, bool) {
+	for slot, d := range diskSlots {
+		if d == dev {
+			return slot, true
+		}
+	}
+
+	return 0, false
+}
+
+func sortedSensors(values map[string]float64) []string {
+	sensors := make([]string, 0, len(values))
+	for sensor := range values {
+		sensors = append(sensors, sensor)
+	}
+	sort.Strings(sensors)
+
+	return sensors
+}
@@ -0,0 +1,129 @@
+package prometheus
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendHwmonFaultMetrics(t *testing.T) {
+	root := t.TempDir()
+	writeSysfsFile(t, root, "hwmon0/name", "it87\n")
+	writeSysfsFile(t, root, "hwmon0/fan1_input", "1200\n")
+	writeSysfsFile(t, root, "hwmon0/fan1_alarm", "0\n")
+	writeSysfsFile(t, root, "hwmon0/fan2_alarm", "0\n")
+	writeSysfsFile(t, root, "hwmon0/fan2_fault", "1\n")
+	writeSysfsFile(t, root, "hwmon0/intrusion0_alarm", "1\n")
+	writeSysfsFile(t, root, "devices/platform/it87.656/.keep", "")
+	require.NoError(t, os.Symlink(path.Join(root, "devices/platform/it87.656"), path.Join(root, "hwmon0/device")))
+	writeSysfsFile(t, root, "hwmon1/name", "coretemp\n")
+
+	metrics := appendHwmonFaultMetrics(nil, root)
+
+	attr := `chip="it87",device="it87.656"`
+	assert.Equal(t, []metric{
+		{name: "node_hwmon_fan_fault", attr: attr + `,sensor="fan1"`, value: 0, help: "Whether the hardware monitor reports a fan alarm or fault", metricType: "gauge"},
+		{name: "node_hwmon_fan_fault", attr: attr + `,sensor="fan2"`, value: 1, help: "Whether the hardware monitor reports a fan alarm or fault", metricType: "gauge"},
+		{name: "node_chassis_intrusion", attr: attr + `,sensor="intrusion0"`, value: 1, help: "Whether the chassis intrusion detection switch was triggered", metricType: "gauge"},
+	}, metrics)
+}
+
+func TestAppendHwmonSensorMetrics(t *testing.T) {
+	root := t.TempDir()
+	writeSysfsFile(t, root, "hwmon0/name", "coretemp\n")
+	writeSysfsFile(t, root, "hwmon0/temp1_input", "45000\n")
+	writeSysfsFile(t, root, "hwmon0/temp1_label", "Package id 0\n")
+	writeSysfsFile(t, root, "hwmon1/name", "it87\n")
+	writeSysfsFile(t, root, "hwmon1/fan1_input", "1150\n")
+	writeSysfsFile(t, root, "hwmon1/in0_input", "1212\n")
+	writeSysfsFile(t, root, "hwmon2/name", "drivetemp\n")
+	writeSysfsFile(t, root, "hwmon2/temp1_input", "38000\n")
+	writeSysfsFile(t, root, "devices/0:0:0:0/block/sda/size", "0\n")
+	require.NoError(t, os.Symlink(path.Join(root, "devices/0:0:0:0"), path.Join(root, "hwmon2/device")))
+
+	metrics := appendHwmonSensorMetrics(nil, (&promExporter{}).readAwakeHwmonChips(root))
+
+	require.Len(t, metrics, 4)
+	assert.Equal(t, metric{
+		name:       "node_hwmon_temp_celsius",
+		attr:       `chip="coretemp",device="",sensor="temp1",label="Package id 0"`,
+		value:      45,
+		help:       "Temperature reported by the hardware monitor",
+		metricType: "gauge",
+	}, metrics[0])
+	assert.Equal(t, "node_hwmon_fan_rpm", metrics[1].name)
+	assert.Equal(t, 1150.0, metrics[1].value)
+	assert.Equal(t, "node_hwmon_in_volts", metrics[2].name)
+	assert.InDelta(t, 1.212, metrics[2].value, 1e-9)
+	assert.Equal(t, `chip="drivetemp",device="sda",sensor="temp1",label=""`, metrics[3].attr)
+	assert.Equal(t, 38.0, metrics[3].value)
+}
+
+func TestReadAwakeHwmonChipsSkipsSleepingDisks(t *testing.T) {
+	root := t.TempDir()
+	writeSysfsFile(t, root, "hwmon0/name", "coretemp\n")
+	writeSysfsFile(t, root, "hwmon1/name", "drivetemp\n")
+	writeSysfsFile(t, root, "devices/0:0:0:0/block/sda/size", "0\n")
+	require.NoError(t, os.Symlink(path.Join(root, "devices/0:0:0:0"), path.Join(root, "hwmon1/device")))
+	writeSysfsFile(t, root, "hwmon2/name", "drivetemp\n")
+	writeSysfsFile(t, root, "devices/1:0:0:0/block/sdb/size", "0\n")
+	require.NoError(t, os.Symlink(path.Join(root, "devices/1:0:0:0"), path.Join(root, "hwmon2/device")))
+
+	e := &promExporter{diskPowerStates: map[string]string{"sda": diskPowerStateStandby, "sdb": diskPowerStateActive}}
+	chips := e.readAwakeHwmonChips(root)
+
+	require.Len(t, chips, 2)
+	assert.Equal(t, "coretemp", chips[0].name)
+	assert.Equal(t, "sdb", chips[1].device)
+}
+
+func TestAppendThermalZoneMetrics(t *testing.T) {
+	root := t.TempDir()
+	writeSysfsFile(t, root, "thermal_zone0/type", "x86_pkg_temp\n")
+	writeSysfsFile(t, root, "thermal_zone0/temp", "51000\n")
+	writeSysfsFile(t, root, "thermal_zone1/type", "acpitz\n")
+
+	metrics := appendThermalZoneMetrics(nil, root)
+
+	assert.Equal(t, []metric{
+		{
+			name:       "node_thermal_zone_temp",
+			attr:       `zone="0",type="x86_pkg_temp"`,
+			value:      51,
+			help:       "Temperature of the thermal zone in degrees Celsius",
+			metricType: "gauge",
+		},
+	}, metrics)
+}
+
+func TestAppendHwmonSysInfoMetrics(t *testing.T) {
+	root := t.TempDir()
+	writeSysfsFile(t, root, "hwmon0/name", "coretemp\n")
+	writeSysfsFile(t, root, "hwmon0/temp1_input", "45000\n")
+	writeSysfsFile(t, root, "hwmon0/temp2_input", "52000\n")
+	writeSysfsFile(t, root, "hwmon1/name", "nct6775\n")
+	writeSysfsFile(t, root, "hwmon1/fan1_input", "900\n")
+	writeSysfsFile(t, root, "hwmon1/fan2_input", "1100\n")
+	writeSysfsFile(t, root, "hwmon2/name", "drivetemp\n")
+	writeSysfsFile(t, root, "hwmon2/temp1_input", "38000\n")
+	writeSysfsFile(t, root, "devices/1:0:0:0/block/sdb/size", "0\n")
+	require.NoError(t, os.Symlink(path.Join(root, "devices/1:0:0:0"), path.Join(root, "hwmon2/device")))
+	// Disks without a slot, e.g. USB disks, are only reported by node_hwmon_temp_celsius
+	writeSysfsFile(t, root, "hwmon3/name", "drivetemp\n")
+	writeSysfsFile(t, root, "hwmon3/temp1_input", "30000\n")
+	writeSysfsFile(t, root, "devices/6:0:0:0/block/sdc/size", "0\n")
+	require.NoError(t, os.Symlink(path.Join(root, "devices/6:0:0:0"), path.Join(root, "hwmon3/device")))
+
+	chips := (&promExporter{}).readAwakeHwmonChips(root)
+	metrics := appendHwmonSysInfoMetrics(nil, chips, map[int]string{1: "sda", 4: "sdb"})
+
+	assert.Equal(t, []metric{
+		{name: "node_sysfan_RPM", attr: `fan="1",type="System"`, value: 900},
+		{name: "node_sysfan_RPM", attr: `fan="2",type="System"`, value: 1100},
+		{name: "node_hdtmp_C", attr: `hd="4",device="sdb"`, value: 38},
+		{name: "node_cputmp_C", value: 52},
+	}, metrics)
+}
@@ -0,0 +1,229 @@
+package prometheus
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pedropombeiro/qnapexporter/lib/utils"
+)
+
+const lioDir = "/sys/kernel/config/target"
+
+var (
+	lioSizeRe        = regexp.MustCompile(`\bSize:\s*(\d+)`)
+	lioBlockDeviceRe = regexp.MustCompile(`iBlock device:\s*(\S+)`)
+)
+
+// iscsiTarget is an iSCSI target portal group exported by the kernel target subsystem (LIO)
+type iscsiTarget struct {
+	name       string
+	tpg        string
+	initiators []string
+	luns       []iscsiLun
+}
+
+// iscsiLun is a LUN of an iSCSI target and the backstore device it is mapped to
+type iscsiLun struct {
+	lun        string
+	backstore  string
+	device     string
+	path       string
+	sizeBytes  float64
+	readBytes  float64
+	writeBytes float64
+	commands   float64
+}
+
+// readIscsiTargets reads the iSCSI targets, their connected initiators and LUNs from the LIO configfs tree under root,
+// looking up the size of block backstores in blockRoot
+func readIscsiTargets(root, blockRoot string) []iscsiTarget {
+	tpgDirs, _ := filepath.Glob(path.Join(root, "iscsi", "iqn.*", "tpgt_*"))
+	sort.Strings(tpgDirs)
+	targets := make([]iscsiTarget, 0, len(tpgDirs))
+	for _, tpgDir := range tpgDirs {
+		target := iscsiTarget{
+			name:       path.Base(path.Dir(tpgDir)),
+			tpg:        strings.TrimPrefix(path.Base(tpgDir), "tpgt_"),
+			initiators: readIscsiInitiators(tpgDir),
+		}
+
+		lunDirs, _ := filepath.Glob(path.Join(tpgDir, "lun", "lun_*"))
+		sort.Strings(lunDirs)
+		for _, lunDir := range lunDirs {
+			target.luns = append(target.luns, readIscsiLun(lunDir, blockRoot))
+		}
+
+		targets = append(targets, target)
+	}
+
+	return targets
+}
+
+// readIscsiInitiators lists the initiators with an active session, whether they connect
+// through an explicit ACL or a dynamically generated one
+func readIscsiInitiators(tpgDir string) []string {
+	var initiators []string
+	if sessions, err := utils.ReadFileLines(path.Join(tpgDir, "dynamic_sessions")); err == nil {
+		for _, s := range sessions {
+			if s = strings.TrimSpace(s); s != "" {
+				initiators = append(initiators, s)
+			}
+		}
+	}
+
+	aclDirs, _ := filepath.Glob(path.Join(tpgDir, "acls", "*"))
+	for _, aclDir := range aclDirs {
+		info, err := utils.ReadFile(path.Join(aclDir, "info"))
+		if err != nil || strings.Contains(info, "No active iSCSI Session") {
+			continue
+		}
+
+		initiators = append(initiators, path.Base(aclDir))
+	}
+	sort.Strings(initiators)
+
+	return initiators
+}
+
+func readIscsiLun(lunDir, blockRoot string) iscsiLun {
+	lun := iscsiLun{lun: strings.TrimPrefix(path.Base(lunDir), "lun_")}
+
+	// Each LUN links to its backstore device in core/<hba>_<index>/<device>
+	entries, _ := os.ReadDir(lunDir)
+	for _, entry := range entries {
+		if entry.Type()&os.ModeSymlink == 0 {
+			continue
+		}
+
+		target, err := filepath.EvalSymlinks(path.Join(lunDir, entry.Name()))
+		if err != nil {
+			continue
+		}
+
+		lun.device = path.Base(target)
+		lun.backstore, _, _ = strings.Cut(path.Base(path.Dir(target)), "_")
+		lun.path, _ = utils.ReadFile(path.Join(target, "udev_path"))
+		if info, err := utils.ReadFile(path.Join(target, "info")); err == nil {
+			lun.sizeBytes = parseLioDeviceSize(info, blockRoot)
+		}
+		break
+	}
+
+	statsDir := path.Join(lunDir, "statistics", "scsi_tgt_port")
+	number := func(name string) float64 {
+		s, _ := utils.ReadFile(path.Join(statsDir, name))
+		v, _ := strconv.ParseFloat(s, 64)
+		return v
+	}
+	lun.readBytes = number("read_mbytes") * 1024 * 1024
+	lun.writeBytes = number("write_mbytes") * 1024 * 1024
+	lun.commands = number("in_cmds")
+
+	return lun
+}
+
+// parseLioDeviceSize returns the size of a backstore device, either reported in its info
+// attribute (fileio, ramdisk) or read from the backing block device (iblock)
+func parseLioDeviceSize(info, blockRoot string) float64 {
+	if matches := lioSizeRe.FindStringSubmatch(info); matches != nil {
+		v, _ := strconv.ParseFloat(matches[1], 64)
+		return v
+	}
+
+	if matches := lioBlockDeviceRe.FindStringSubmatch(info); matches != nil {
+		if sectors, err := utils.ReadFile(path.Join(blockRoot, matches[1], "size")); err == nil {
+			v, _ := strconv.ParseFloat(sectors, 64)
+			return v * 512
+		}
+	}
+
+	return 0
+}
+
+func getIscsiMetrics() ([]metric, error) {
+	if _, err := os.Stat(path.Join(lioDir, "iscsi")); err != nil {
+		// Ignore if the iSCSI target module is not loaded
+		return nil, nil
+	}
+
+	targets := readIscsiTargets(lioDir, blockDir)
+	metrics := make([]metric, 0, len(targets)*8)
+	for _, t := range targets {
+		metrics = append(metrics, iscsiTargetMetrics(t)...)
+	}
+
+	return metrics, nil
+}
+
+func iscsiTargetMetrics(t iscsiTarget) []metric {
+	attr := fmt.Sprintf("target=%q,tpg=%q", t.name, t.tpg)
+	metrics := []metric{
+		{
+			name:       "node_iscsi_target_sessions",
+			attr:       attr,
+			value:      float64(len(t.initiators)),
+			help:       "Number of initiators with an active session to the iSCSI target",
+			metricType: "gauge",
+		},
+	}
+
+	for _, initiator := range t.initiators {
+		metrics = append(metrics, metric{
+			name:       "node_iscsi_initiator_connected",
+			attr:       fmt.Sprintf("%s,initiator=%q", attr, initiator),
+			value:      1,
+			help:       "Initiators with an active session to the iSCSI target",
+			metricType: "gauge",
+		})
+	}
+
+	for _, l := range t.luns {
+		lunAttr := fmt.Sprintf("%s,lun=%q", attr, l.lun)
+		metrics = append(
+			metrics,
+			metric{
+				name:       "node_iscsi_lun_info",
+				attr:       fmt.Sprintf("%s,backstore=%q,device=%q,path=%q", lunAttr, l.backstore, l.device, l.path),
+				value:      1,
+				help:       "Backstore device and backing volume of the iSCSI LUN",
+				metricType: "gauge",
+			},
+			metric{
+				name:       "node_iscsi_lun_size_bytes",
+				attr:       lunAttr,
+				value:      l.sizeBytes,
+				help:       "Size of the iSCSI LUN",
+				metricType: "gauge",
+			},
+			metric{
+				name:       "node_iscsi_lun_read_bytes_total",
+				attr:       lunAttr,
+				value:      l.readBytes,
+				help:       "Number of bytes read by initiators from the iSCSI LUN",
+				metricType: "counter",
+			},
+			metric{
+				name:       "node_iscsi_lun_written_bytes_total",
+				attr:       lunAttr,
+				value:      l.writeBytes,
+				help:       "Number of bytes written by initiators to the iSCSI LUN",
+				metricType: "counter",
+			},
+			metric{
+				name:       "node_iscsi_lun_commands_total",
+				attr:       lunAttr,
+				value:      l.commands,
+				help:       "Number of SCSI commands received for the iSCSI LUN",
+				metricType: "counter",
+			},
+		)
+	}
+
+	return metrics
+}
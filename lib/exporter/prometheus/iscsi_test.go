@@ -0,0 +1,69 @@
+package prometheus
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadIscsiTargets(t *testing.T) {
+	root := t.TempDir()
+	blockRoot := t.TempDir()
+	tpg := "iscsi/iqn.2004-04.com.qnap:ts-453d:iscsi.vmstore.a1b2c3/tpgt_1"
+
+	writeSysfsFile(t, root, "core/iblock_0/lun0/udev_path", "/dev/mapper/cachedev1\n")
+	writeSysfsFile(t, root, "core/iblock_0/lun0/info", "Status: ACTIVATED  Max Queue Depth: 128  SectorSize: 512  HwMaxSectors: 1024\n        iBlock device: dm-3  UDEV PATH: /dev/mapper/cachedev1\n")
+	writeSysfsFile(t, blockRoot, "dm-3/size", "2097152\n")
+	writeSysfsFile(t, root, "core/fileio_1/lun1/udev_path", "/share/VM/disk1.img\n")
+	writeSysfsFile(t, root, "core/fileio_1/lun1/info", "Status: ACTIVATED  Max Queue Depth: 128\n        TCM FILEIO ID: 0        File: /share/VM/disk1.img  Size: 10737418240  Mode: O_DSYNC\n")
+
+	writeSysfsFile(t, root, tpg+"/lun/lun_0/statistics/scsi_tgt_port/read_mbytes", "10\n")
+	writeSysfsFile(t, root, tpg+"/lun/lun_0/statistics/scsi_tgt_port/write_mbytes", "2\n")
+	writeSysfsFile(t, root, tpg+"/lun/lun_0/statistics/scsi_tgt_port/in_cmds", "1500\n")
+	require.NoError(t, os.Symlink(path.Join(root, "core/iblock_0/lun0"), path.Join(root, tpg, "lun/lun_0/a1b2c3d4")))
+	writeSysfsFile(t, root, tpg+"/lun/lun_1/statistics/scsi_tgt_port/in_cmds", "0\n")
+	require.NoError(t, os.Symlink(path.Join(root, "core/fileio_1/lun1"), path.Join(root, tpg, "lun/lun_1/e5f6a7b8")))
+
+	writeSysfsFile(t, root, tpg+"/dynamic_sessions", "iqn.1991-05.com.microsoft:hyperv1\n")
+	writeSysfsFile(t, root, tpg+"/acls/iqn.1998-01.com.vmware:esx1/info", "InitiatorName: iqn.1998-01.com.vmware:esx1\nSession State: TARG_SESS_STATE_LOGGED_IN\n")
+	writeSysfsFile(t, root, tpg+"/acls/iqn.1998-01.com.vmware:esx2/info", "No active iSCSI Session for Initiator Endpoint: iqn.1998-01.com.vmware:esx2\n")
+
+	targets := readIscsiTargets(root, blockRoot)
+
+	require.Len(t, targets, 1)
+	assert.Equal(t, iscsiTarget{
+		name:       "iqn.2004-04.com.qnap:ts-453d:iscsi.vmstore.a1b2c3",
+		tpg:        "1",
+		initiators: []string{"iqn.1991-05.com.microsoft:hyperv1", "iqn.1998-01.com.vmware:esx1"},
+		luns: []iscsiLun{
+			{
+				lun:        "0",
+				backstore:  "iblock",
+				device:     "lun0",
+				path:       "/dev/mapper/cachedev1",
+				sizeBytes:  2097152 * 512,
+				readBytes:  10 * 1024 * 1024,
+				writeBytes: 2 * 1024 * 1024,
+				commands:   1500,
+			},
+			{
+				lun:       "1",
+				backstore: "fileio",
+				device:    "lun1",
+				path:      "/share/VM/disk1.img",
+				sizeBytes: 10737418240,
+			},
+		},
+	}, targets[0])
+
+	metrics := iscsiTargetMetrics(targets[0])
+	require.Len(t, metrics, 1+2+2*5)
+	assert.Equal(t, 2.0, metrics[0].value)
+	assert.Equal(t,
+		`target="iqn.2004-04.com.qnap:ts-453d:iscsi.vmstore.a1b2c3",tpg="1",lun="0",backstore="iblock",device="lun0",path="/dev/mapper/cachedev1"`,
+		metrics[3].attr,
+	)
+}
@@ -0,0 +1,198 @@
+package prometheus
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pedropombeiro/qnapexporter/lib/utils"
+)
+
+// QvsVirshPath is where Virtualization Station installs virsh, which is not in the default PATH
+const QvsVirshPath = "/QVS/usr/bin/virsh"
+
+// vmStates lists the libvirt domain states, indexed by their virDomainState value
+var vmStates = []string{"nostate", "running", "blocked", "paused", "shutdown", "shutoff", "crashed", "pmsuspended"}
+
+// vmDomain holds the statistics of a libvirt domain reported by `virsh domstats --raw`
+type vmDomain struct {
+	name  string
+	stats map[string]string
+}
+
+func (e *promExporter) readVirshPath() {
+	if e.virsh != "" {
+		return
+	}
+
+	e.virsh, _ = utils.LookPath("virsh", QvsVirshPath)
+	if e.virsh != "" {
+		e.Logger.Printf("Retrieved virsh path: %q", e.virsh)
+	}
+}
+
+// parseVirshDomstats parses the output of `virsh domstats --raw`:
+//
+//	Domain: 'vm1'
+//	  state.state=1
+//	  cpu.time=123456789000
+func parseVirshDomstats(output string) []vmDomain {
+	var domains []vmDomain
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if name, ok := strings.CutPrefix(line, "Domain:"); ok {
+			domains = append(domains, vmDomain{
+				name:  strings.Trim(strings.TrimSpace(name), "'"),
+				stats: make(map[string]string),
+			})
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || len(domains) == 0 {
+			continue
+		}
+		domains[len(domains)-1].stats[key] = value
+	}
+
+	return domains
+}
+
+func (e *promExporter) getLibvirtMetrics() ([]metric, error) {
+	if e.virsh == "" {
+		return nil, nil
+	}
+
+	output, err := utils.ExecCommand(e.virsh, "domstats", "--raw")
+	if err != nil {
+		return nil, fmt.Errorf("get VM statistics: %w", err)
+	}
+
+	var metrics []metric
+	for _, d := range parseVirshDomstats(output) {
+		metrics = append(metrics, vmDomainMetrics(d)...)
+	}
+
+	return metrics, nil
+}
+
+func vmDomainMetrics(d vmDomain) []metric {
+	number := func(key string) float64 {
+		v, _ := strconv.ParseFloat(d.stats[key], 64)
+		return v
+	}
+
+	attr := fmt.Sprintf("domain=%q", d.name)
+	state := "nostate"
+	if idx, err := strconv.Atoi(d.stats["state.state"]); err == nil && idx >= 0 && idx < len(vmStates) {
+		state = vmStates[idx]
+	}
+
+	metrics := appendStateSetMetrics(nil, "node_vm_state", attr, "state", vmStates, state, "State of the virtual machine")
+	metrics = append(
+		metrics,
+		metric{
+			name:       "node_vm_cpu_seconds_total",
+			attr:       attr,
+			value:      number("cpu.time") / 1e9,
+			help:       "CPU time spent by the virtual machine",
+			metricType: "counter",
+		},
+		metric{
+			name:       "node_vm_vcpus",
+			attr:       attr,
+			value:      number("vcpu.current"),
+			help:       "Number of virtual CPUs of the virtual machine",
+			metricType: "gauge",
+		},
+		metric{
+			name:       "node_vm_memory_balloon_bytes",
+			attr:       attr,
+			value:      number("balloon.current") * 1024,
+			help:       "Memory currently assigned to the virtual machine through the balloon driver",
+			metricType: "gauge",
+		},
+		metric{
+			name:       "node_vm_memory_maximum_bytes",
+			attr:       attr,
+			value:      number("balloon.maximum") * 1024,
+			help:       "Maximum memory of the virtual machine",
+			metricType: "gauge",
+		},
+		metric{
+			name:       "node_vm_memory_rss_bytes",
+			attr:       attr,
+			value:      number("balloon.rss") * 1024,
+			help:       "Host memory used by the virtual machine process",
+			metricType: "gauge",
+		},
+	)
+
+	for _, idx := range vmDeviceIndexes(d, "block") {
+		prefix := "block." + idx + "."
+		devAttr := fmt.Sprintf("%s,device=%q", attr, d.stats[prefix+"name"])
+		metrics = append(
+			metrics,
+			metric{
+				name:       "node_vm_disk_read_bytes_total",
+				attr:       devAttr,
+				value:      number(prefix + "rd.bytes"),
+				help:       "Number of bytes read from the virtual machine disk",
+				metricType: "counter",
+			},
+			metric{
+				name:       "node_vm_disk_written_bytes_total",
+				attr:       devAttr,
+				value:      number(prefix + "wr.bytes"),
+				help:       "Number of bytes written to the virtual machine disk",
+				metricType: "counter",
+			},
+		)
+	}
+
+	for _, idx := range vmDeviceIndexes(d, "net") {
+		prefix := "net." + idx + "."
+		ifAttr := fmt.Sprintf("%s,interface=%q", attr, d.stats[prefix+"name"])
+		metrics = append(
+			metrics,
+			metric{
+				name:       "node_vm_network_receive_bytes_total",
+				attr:       ifAttr,
+				value:      number(prefix + "rx.bytes"),
+				help:       "Number of bytes received by the virtual machine network interface",
+				metricType: "counter",
+			},
+			metric{
+				name:       "node_vm_network_transmit_bytes_total",
+				attr:       ifAttr,
+				value:      number(prefix + "tx.bytes"),
+				help:       "Number of bytes transmitted by the virtual machine network interface",
+				metricType: "counter",
+			},
+		)
+	}
+
+	return metrics
+}
+
+// vmDeviceIndexes returns the indexes of the block or net devices of the domain, from its <kind>.<index>.name stats
+func vmDeviceIndexes(d vmDomain, kind string) []string {
+	var indexes []string
+	for key := range d.stats {
+		idx, ok := strings.CutPrefix(key, kind+".")
+		if !ok {
+			continue
+		}
+		if idx, ok = strings.CutSuffix(idx, ".name"); ok {
+			indexes = append(indexes, idx)
+		}
+	}
+	sort.Slice(indexes, func(i, j int) bool {
+		a, _ := strconv.Atoi(indexes[i])
+		b, _ := strconv.Atoi(indexes[j])
+		return a < b
+	})
+
+	return indexes
+}
@@ -0,0 +1,81 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const virshDomstatsOutput = `Domain: 'Home Assistant'
+  state.state=1
+  state.reason=1
+  cpu.time=125000000000
+  cpu.user=100000000000
+  cpu.system=25000000000
+  balloon.current=2097152
+  balloon.maximum=4194304
+  balloon.rss=1048576
+  vcpu.current=2
+  vcpu.maximum=2
+  net.count=1
+  net.0.name=vnet0
+  net.0.rx.bytes=1000
+  net.0.tx.bytes=2000
+  block.count=2
+  block.0.name=vda
+  block.0.path=/share/VM/ha.img
+  block.0.rd.bytes=4096
+  block.0.wr.bytes=8192
+  block.1.name=sda
+  block.1.rd.bytes=512
+
+Domain: 'Windows'
+  state.state=5
+  state.reason=1
+  balloon.maximum=8388608
+`
+
+func TestParseVirshDomstats(t *testing.T) {
+	domains := parseVirshDomstats(virshDomstatsOutput)
+
+	require.Len(t, domains, 2)
+	assert.Equal(t, "Home Assistant", domains[0].name)
+	assert.Equal(t, "125000000000", domains[0].stats["cpu.time"])
+	assert.Equal(t, "/share/VM/ha.img", domains[0].stats["block.0.path"])
+	assert.Equal(t, "Windows", domains[1].name)
+	assert.Equal(t, map[string]string{"state.state": "5", "state.reason": "1", "balloon.maximum": "8388608"}, domains[1].stats)
+}
+
+func TestVmDomainMetrics(t *testing.T) {
+	domains := parseVirshDomstats(virshDomstatsOutput)
+	metrics := vmDomainMetrics(domains[0])
+
+	const attr = `domain="Home Assistant"`
+	expected := map[[2]string]float64{
+		{"node_vm_state", attr + `,state="running"`}:                          1,
+		{"node_vm_state", attr + `,state="shutoff"`}:                          0,
+		{"node_vm_cpu_seconds_total", attr}:                                   125,
+		{"node_vm_vcpus", attr}:                                               2,
+		{"node_vm_memory_balloon_bytes", attr}:                                2 * 1024 * 1024 * 1024,
+		{"node_vm_memory_maximum_bytes", attr}:                                4 * 1024 * 1024 * 1024,
+		{"node_vm_memory_rss_bytes", attr}:                                    1024 * 1024 * 1024,
+		{"node_vm_disk_read_bytes_total", attr + `,device="vda"`}:             4096,
+		{"node_vm_disk_written_bytes_total", attr + `,device="vda"`}:          8192,
+		{"node_vm_disk_read_bytes_total", attr + `,device="sda"`}:             512,
+		{"node_vm_network_receive_bytes_total", attr + `,interface="vnet0"`}:  1000,
+		{"node_vm_network_transmit_bytes_total", attr + `,interface="vnet0"`}: 2000,
+	}
+	for key, value := range expected {
+		m, ok := findMetric(metrics, key[0], key[1])
+		require.True(t, ok, key)
+		assert.Equal(t, value, m.value, key)
+	}
+	assert.Len(t, metrics, len(vmStates)+5+2*2+2)
+
+	metrics = vmDomainMetrics(domains[1])
+	m, ok := findMetric(metrics, "node_vm_state", `domain="Windows",state="shutoff"`)
+	require.True(t, ok)
+	assert.Equal(t, 1.0, m.value)
+	assert.Len(t, metrics, len(vmStates)+5)
+}
@@ -0,0 +1,316 @@
+package prometheus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pedropombeiro/qnapexporter/lib/utils"
+)
+
+var lvsFields = []string{
+	"vg_name",
+	"lv_name",
+	"lv_attr",
+	"segtype",
+	"pool_lv",
+	"origin",
+	"lv_size",
+	"data_percent",
+	"metadata_percent",
+	"lv_metadata_size",
+}
+
+// lvmVolume holds the attributes of a logical volume as reported by `lvs`
+type lvmVolume struct {
+	vg                string
+	name              string
+	attr              string
+	segType           string
+	pool              string
+	origin            string
+	sizeBytes         float64
+	dataPercent       float64
+	metadataPercent   float64
+	metadataSizeBytes float64
+}
+
+func (v *lvmVolume) isThinPool() bool {
+	return v.segType == "thin-pool" || strings.HasPrefix(v.attr, "t")
+}
+
+func (v *lvmVolume) isSnapshot() bool {
+	return v.origin != "" || strings.HasPrefix(v.attr, "s")
+}
+
+// thinPoolStatus holds the usage of a thin-pool device mapper target as reported by `dmsetup status`
+type thinPoolStatus struct {
+	name          string
+	metadataUsed  float64
+	metadataTotal float64
+	dataUsed      float64
+	dataTotal     float64
+}
+
+func (e *promExporter) readLvsPath() {
+	if e.lvs != "" {
+		return
+	}
+
+	e.lvs, _ = exec.LookPath("lvs")
+	if e.lvs != "" {
+		e.Logger.Printf("Retrieved lvs path: %q", e.lvs)
+	}
+}
+
+// parseLvsJSON parses the output of `lvs --reportformat json --units b --nosuffix`
+func parseLvsJSON(output string) ([]lvmVolume, error) {
+	var report struct {
+		Report []struct {
+			LV []map[string]string `json:"lv"`
+		} `json:"report"`
+	}
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		return nil, fmt.Errorf("parse lvs report: %w", err)
+	}
+
+	var volumes []lvmVolume
+	for _, r := range report.Report {
+		for _, lv := range r.LV {
+			number := func(key string) float64 {
+				v, _ := strconv.ParseFloat(strings.TrimSpace(lv[key]), 64)
+				return v
+			}
+
+			volumes = append(volumes, lvmVolume{
+				vg:                lv["vg_name"],
+				name:              lv["lv_name"],
+				attr:              lv["lv_attr"],
+				segType:           lv["segtype"],
+				pool:              lv["pool_lv"],
+				origin:            lv["origin"],
+				sizeBytes:         number("lv_size"),
+				dataPercent:       number("data_percent"),
+				metadataPercent:   number("metadata_percent"),
+				metadataSizeBytes: number("lv_metadata_size"),
+			})
+		}
+	}
+
+	return volumes, nil
+}
+
+// parseDmThinPoolStatus parses the output of `dmsetup status --target thin-pool`
+func parseDmThinPoolStatus(lines []string) []thinPoolStatus {
+	pools := make([]thinPoolStatus, 0, len(lines))
+	for _, line := range lines {
+		tokens := strings.Fields(line)
+		// <name>: <start> <length> thin-pool <transaction id> <used>/<total metadata> <used>/<total data> ...
+		if len(tokens) < 7 || tokens[3] != "thin-pool" {
+			continue
+		}
+
+		pool := thinPoolStatus{name: strings.TrimSuffix(tokens[0], ":")}
+		pool.metadataUsed, pool.metadataTotal = parseUsedTotal(tokens[5])
+		pool.dataUsed, pool.dataTotal = parseUsedTotal(tokens[6])
+		pools = append(pools, pool)
+	}
+
+	return pools
+}
+
+// splitDmName splits the device-mapper name of a logical volume, e.g. vg1-tp1-tpool, into its
+// volume group, logical volume and layer names, where a dash within a name is escaped as --
+func splitDmName(name string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i < len(name); i++ {
+		if name[i] != '-' {
+			continue
+		}
+		if i+1 < len(name) && name[i+1] == '-' {
+			i++
+			continue
+		}
+		parts = append(parts, strings.ReplaceAll(name[start:i], "--", "-"))
+		start = i + 1
+	}
+
+	return append(parts, strings.ReplaceAll(name[start:], "--", "-"))
+}
+
+func parseUsedTotal(s string) (float64, float64) {
+	tokens := strings.SplitN(s, "/", 2)
+	if len(tokens) != 2 {
+		return 0, 0
+	}
+
+	used, _ := strconv.ParseFloat(tokens[0], 64)
+	total, _ := strconv.ParseFloat(tokens[1], 64)
+	return used, total
+}
+
+func (e *promExporter) getLvmMetrics() ([]metric, error) {
+	if e.lvs != "" {
+		var volumes []lvmVolume
+		output, err := utils.ExecCommand(e.lvs, "--reportformat", "json", "--units", "b", "--nosuffix", "-a", "-o", strings.Join(lvsFields, ","))
+		if err == nil {
+			volumes, err = parseLvsJSON(output)
+		}
+		if err == nil {
+			return lvmMetrics(volumes), nil
+		}
+		e.Logger.Printf("Failed to retrieve LVM report, falling back to dmsetup: %v", err)
+	}
+
+	lines, err := utils.ExecCommandGetLines("dmsetup", "status", "--target", "thin-pool")
+	if errors.Is(err, exec.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get thin-pool status: %w", err)
+	}
+
+	return thinPoolStatusMetrics(parseDmThinPoolStatus(lines)), nil
+}
+
+func lvmMetrics(volumes []lvmVolume) []metric {
+	metrics := make([]metric, 0, len(volumes)*4)
+	snapshots := make(map[string]int)
+	for _, v := range volumes {
+		if strings.HasPrefix(v.name, "[") {
+			// Hidden volumes (e.g. [tp1_tdata]) are accounted for in their pool
+			continue
+		}
+
+		if v.isThinPool() {
+			attr := fmt.Sprintf("vg=%q,pool=%q", v.vg, v.name)
+			metrics = append(
+				metrics,
+				metric{
+					name:       "node_lvm_thin_pool_data_size_bytes",
+					attr:       attr,
+					value:      v.sizeBytes,
+					help:       "Size of the thin pool data volume in bytes",
+					metricType: "gauge",
+				},
+				metric{
+					name:       "node_lvm_thin_pool_data_used_ratio",
+					attr:       attr,
+					value:      v.dataPercent / 100,
+					help:       "Ratio of the thin pool data space that is allocated",
+					metricType: "gauge",
+				},
+				metric{
+					name:       "node_lvm_thin_pool_metadata_size_bytes",
+					attr:       attr,
+					value:      v.metadataSizeBytes,
+					help:       "Size of the thin pool metadata volume in bytes",
+					metricType: "gauge",
+				},
+				metric{
+					name:       "node_lvm_thin_pool_metadata_used_ratio",
+					attr:       attr,
+					value:      v.metadataPercent / 100,
+					help:       "Ratio of the thin pool metadata space that is allocated",
+					metricType: "gauge",
+				},
+			)
+			continue
+		}
+
+		if v.isSnapshot() {
+			snapshots[fmt.Sprintf("vg=%q,origin=%q", v.vg, v.origin)]++
+			attr := fmt.Sprintf("vg=%q,lv=%q,origin=%q,pool=%q", v.vg, v.name, v.origin, v.pool)
+			metrics = append(
+				metrics,
+				metric{
+					name:       "node_lvm_snapshot_size_bytes",
+					attr:       attr,
+					value:      v.sizeBytes,
+					help:       "Virtual size of the snapshot in bytes",
+					metricType: "gauge",
+				},
+				metric{
+					name:       "node_lvm_snapshot_allocated_bytes",
+					attr:       attr,
+					value:      v.sizeBytes * v.dataPercent / 100,
+					help:       "Space allocated to the snapshot in bytes",
+					metricType: "gauge",
+				},
+			)
+			continue
+		}
+
+		attr := fmt.Sprintf("vg=%q,lv=%q,pool=%q", v.vg, v.name, v.pool)
+		metrics = append(metrics, metric{
+			name:       "node_lvm_lv_size_bytes",
+			attr:       attr,
+			value:      v.sizeBytes,
+			help:       "Size of the logical volume in bytes",
+			metricType: "gauge",
+		})
+		if v.pool != "" {
+			metrics = append(metrics, metric{
+				name:       "node_lvm_lv_allocated_ratio",
+				attr:       attr,
+				value:      v.dataPercent / 100,
+				help:       "Ratio of the thin logical volume that is allocated in its pool",
+				metricType: "gauge",
+			})
+		}
+	}
+
+	origins := make([]string, 0, len(snapshots))
+	for origin := range snapshots {
+		origins = append(origins, origin)
+	}
+	sort.Strings(origins)
+	for _, origin := range origins {
+		metrics = append(metrics, metric{
+			name:       "node_lvm_snapshots",
+			attr:       origin,
+			value:      float64(snapshots[origin]),
+			help:       "Number of snapshots of the logical volume",
+			metricType: "gauge",
+		})
+	}
+
+	return metrics
+}
+
+func thinPoolStatusMetrics(pools []thinPoolStatus) []metric {
+	metrics := make([]metric, 0, len(pools)*2)
+	for _, p := range pools {
+		vg, pool := "", p.name
+		if parts := splitDmName(p.name); len(parts) > 1 {
+			// Drop the layer suffix (e.g. -tpool) to label the pool as lvs does
+			vg, pool = parts[0], parts[1]
+		}
+		attr := fmt.Sprintf("vg=%q,pool=%q", vg, pool)
+		if p.dataTotal > 0 {
+			metrics = append(metrics, metric{
+				name:       "node_lvm_thin_pool_data_used_ratio",
+				attr:       attr,
+				value:      p.dataUsed / p.dataTotal,
+				help:       "Ratio of the thin pool data space that is allocated",
+				metricType: "gauge",
+			})
+		}
+		if p.metadataTotal > 0 {
+			metrics = append(metrics, metric{
+				name:       "node_lvm_thin_pool_metadata_used_ratio",
+				attr:       attr,
+				value:      p.metadataUsed / p.metadataTotal,
+				help:       "Ratio of the thin pool metadata space that is allocated",
+				metricType: "gauge",
+			})
+		}
+	}
+
+	return metrics
+}
@@ -0,0 +1,87 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLvsJSON(t *testing.T) {
+	volumes, err := parseLvsJSON(`{
+  "report": [
+    {
+      "lv": [
+        {"vg_name":"vg1", "lv_name":"tp1", "lv_attr":"twi-aotz--", "segtype":"thin-pool", "pool_lv":"", "origin":"", "lv_size":"1000000", "data_percent":"42.50", "metadata_percent":"3.00", "lv_metadata_size":"1000"},
+        {"vg_name":"vg1", "lv_name":"[tp1_tdata]", "lv_attr":"Twi-ao----", "segtype":"linear", "pool_lv":"", "origin":"", "lv_size":"1000000", "data_percent":"", "metadata_percent":"", "lv_metadata_size":""},
+        {"vg_name":"vg1", "lv_name":"lv1", "lv_attr":"Vwi-aot---", "segtype":"thin", "pool_lv":"tp1", "origin":"", "lv_size":"500000", "data_percent":"80.00", "metadata_percent":"", "lv_metadata_size":""},
+        {"vg_name":"vg1", "lv_name":"snap10001", "lv_attr":"Vwi---t--k", "segtype":"thin", "pool_lv":"tp1", "origin":"lv1", "lv_size":"500000", "data_percent":"10.00", "metadata_percent":"", "lv_metadata_size":""},
+        {"vg_name":"vg1", "lv_name":"snap10002", "lv_attr":"Vwi---t--k", "segtype":"thin", "pool_lv":"tp1", "origin":"lv1", "lv_size":"500000", "data_percent":"20.00", "metadata_percent":"", "lv_metadata_size":""}
+      ]
+    }
+  ]
+}`)
+	require.NoError(t, err)
+	require.Len(t, volumes, 5)
+	assert.True(t, volumes[0].isThinPool())
+	assert.False(t, volumes[2].isSnapshot())
+	assert.True(t, volumes[3].isSnapshot())
+
+	values := map[string]float64{}
+	for _, m := range lvmMetrics(volumes) {
+		values[m.name+"{"+m.attr+"}"] = m.value
+	}
+
+	assert.Equal(t, map[string]float64{
+		`node_lvm_thin_pool_data_size_bytes{vg="vg1",pool="tp1"}`:                            1000000,
+		`node_lvm_thin_pool_data_used_ratio{vg="vg1",pool="tp1"}`:                            0.425,
+		`node_lvm_thin_pool_metadata_size_bytes{vg="vg1",pool="tp1"}`:                        1000,
+		`node_lvm_thin_pool_metadata_used_ratio{vg="vg1",pool="tp1"}`:                        0.03,
+		`node_lvm_lv_size_bytes{vg="vg1",lv="lv1",pool="tp1"}`:                               500000,
+		`node_lvm_lv_allocated_ratio{vg="vg1",lv="lv1",pool="tp1"}`:                          0.8,
+		`node_lvm_snapshot_size_bytes{vg="vg1",lv="snap10001",origin="lv1",pool="tp1"}`:      500000,
+		`node_lvm_snapshot_allocated_bytes{vg="vg1",lv="snap10001",origin="lv1",pool="tp1"}`: 50000,
+		`node_lvm_snapshot_size_bytes{vg="vg1",lv="snap10002",origin="lv1",pool="tp1"}`:      500000,
+		`node_lvm_snapshot_allocated_bytes{vg="vg1",lv="snap10002",origin="lv1",pool="tp1"}`: 100000,
+		`node_lvm_snapshots{vg="vg1",origin="lv1"}`:                                          2,
+	}, values)
+}
+
+func TestParseDmThinPoolStatus(t *testing.T) {
+	pools := parseDmThinPoolStatus([]string{
+		"vg1-tp1-tpool: 0 15032385536 thin-pool 12 1024/4096 750/1000 - rw discard_passdown queue_if_no_space - 1024",
+		"No devices found",
+	})
+
+	require.Len(t, pools, 1)
+	assert.Equal(t, thinPoolStatus{
+		name:          "vg1-tp1-tpool",
+		metadataUsed:  1024,
+		metadataTotal: 4096,
+		dataUsed:      750,
+		dataTotal:     1000,
+	}, pools[0])
+
+	metrics := thinPoolStatusMetrics(pools)
+	require.Len(t, metrics, 2)
+	assert.Equal(t, `vg="vg1",pool="tp1"`, metrics[0].attr)
+	assert.Equal(t, 0.75, metrics[0].value)
+	assert.Equal(t, 0.25, metrics[1].value)
+}
+
+func TestSplitDmName(t *testing.T) {
+	testCases := map[string][]string{
+		"vg1-tp1-tpool":       {"vg1", "tp1", "tpool"},
+		"vg1-tp1":             {"vg1", "tp1"},
+		"my--vg-thin--pool":   {"my-vg", "thin-pool"},
+		"vg--1-tp---x-tpool":  {"vg-1", "tp-", "x", "tpool"},
+		"cachedev1":           {"cachedev1"},
+		"data--vg-pool-tpool": {"data-vg", "pool", "tpool"},
+	}
+
+	for name, expected := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, expected, splitDmName(name))
+		})
+	}
+}
@@ -0,0 +1,320 @@
+package prometheus
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pedropombeiro/qnapexporter/lib/utils"
+)
+
+const mdstatPath = "/proc/mdstat"
+
+var (
+	mdArrayLineRe   = regexp.MustCompile(`^(md\d+)\s*:\s*(\S+)\s*(.*)$`)
+	mdMemberRe      = regexp.MustCompile(`^(\S+)\[(\d+)\]((?:\([A-Z]\))*)$`)
+	mdBlocksRe      = regexp.MustCompile(`^\s*(\d+) blocks`)
+	mdDiskCountRe   = regexp.MustCompile(`\[(\d+)/(\d+)\]`)
+	mdProgressRe    = regexp.MustCompile(`(resync|recovery|check|repair|reshape)\s*=\s*([\d.]+)%`)
+	mdDelayedRe     = regexp.MustCompile(`(resync|recovery|check|repair|reshape)\s*=\s*(DELAYED|PENDING)`)
+	mdSyncSpeedRe   = regexp.MustCompile(`speed=(\d+)K/sec`)
+	mdPersonalities = []string{"linear", "multipath", "raid0", "raid1", "raid4", "raid5", "raid6", "raid10", "faulty"}
+
+	// mdArrayStates lists the values of /sys/block/md*/md/array_state
+	mdArrayStates = []string{"clear", "inactive", "suspended", "readonly", "read-auto", "clean", "active", "write-pending", "active-idle"}
+	// mdSyncActions lists the values of /sys/block/md*/md/sync_action
+	mdSyncActions = []string{"idle", "resync", "recover", "check", "repair", "reshape", "frozen"}
+	// mdMemberStates lists the states exported for each array member
+	mdMemberStates = []string{"active", "faulty", "spare"}
+)
+
+type mdMember struct {
+	name  string
+	slot  string
+	state string
+}
+
+type mdArray struct {
+	name          string
+	state         string
+	level         string
+	members       []mdMember
+	raidDisks     int
+	activeDisks   int
+	sizeBytes     float64
+	syncAction    string
+	syncCompleted float64
+	syncSpeed     float64
+}
+
+func (a *mdArray) countMembers(state string) int {
+	count := 0
+	for _, m := range a.members {
+		if m.state == state {
+			count++
+		}
+	}
+
+	return count
+}
+
+// parseMdstat parses the contents of /proc/mdstat
+func parseMdstat(content string) []mdArray {
+	var arrays []mdArray
+	var current *mdArray
+	for _, line := range strings.Split(content, "\n") {
+		if matches := mdArrayLineRe.FindStringSubmatch(line); matches != nil {
+			arrays = append(arrays, parseMdArrayLine(matches))
+			current = &arrays[len(arrays)-1]
+			continue
+		}
+		if current == nil || strings.TrimSpace(line) == "" {
+			current = nil
+			continue
+		}
+
+		if matches := mdBlocksRe.FindStringSubmatch(line); matches != nil {
+			blocks, _ := strconv.ParseFloat(matches[1], 64)
+			current.sizeBytes = blocks * 1024
+		}
+		if matches := mdDiskCountRe.FindStringSubmatch(line); matches != nil {
+			current.raidDisks, _ = strconv.Atoi(matches[1])
+			current.activeDisks, _ = strconv.Atoi(matches[2])
+		}
+		if matches := mdProgressRe.FindStringSubmatch(line); matches != nil {
+			current.syncAction = mdSyncAction(matches[1])
+			progress, _ := strconv.ParseFloat(matches[2], 64)
+			current.syncCompleted = progress / 100
+		} else if matches := mdDelayedRe.FindStringSubmatch(line); matches != nil {
+			current.syncAction = mdSyncAction(matches[1])
+		}
+		if matches := mdSyncSpeedRe.FindStringSubmatch(line); matches != nil {
+			speed, _ := strconv.ParseFloat(matches[1], 64)
+			current.syncSpeed = speed * 1024
+		}
+	}
+
+	for idx := range arrays {
+		a := &arrays[idx]
+		if a.raidDisks == 0 {
+			// Arrays without redundancy do not report [n/m]
+			a.raidDisks = a.countMembers("active")
+			a.activeDisks = a.raidDisks
+		}
+		if a.syncAction == "" {
+			a.syncAction = "idle"
+		}
+	}
+
+	return arrays
+}
+
+func parseMdArrayLine(matches []string) mdArray {
+	a := mdArray{name: matches[1], state: matches[2]}
+	for _, token := range strings.Fields(matches[3]) {
+		switch {
+		case strings.HasPrefix(token, "("):
+			// e.g. (auto-read-only)
+			if token == "(auto-read-only)" {
+				a.state = "read-auto"
+			} else if token == "(read-only)" {
+				a.state = "readonly"
+			}
+		case isMdPersonality(token):
+			a.level = token
+		default:
+			if m := mdMemberRe.FindStringSubmatch(token); m != nil {
+				state := "active"
+				switch {
+				case strings.Contains(m[3], "(F)"):
+					state = "faulty"
+				case strings.Contains(m[3], "(S)"):
+					state = "spare"
+				}
+				a.members = append(a.members, mdMember{name: m[1], slot: m[2], state: state})
+			}
+		}
+	}
+
+	return a
+}
+
+func isMdPersonality(token string) bool {
+	for _, p := range mdPersonalities {
+		if token == p {
+			return true
+		}
+	}
+
+	return false
+}
+
+func mdSyncAction(action string) string {
+	if action == "recovery" {
+		return "recover"
+	}
+
+	return action
+}
+
+// readMdSysfs refines the array information parsed from /proc/mdstat with the
+// more detailed state exposed in /sys/block/md*/md
+func readMdSysfs(root string, a *mdArray) {
+	mdDir := path.Join(root, a.name, "md")
+
+	if state, err := utils.ReadFile(path.Join(mdDir, "array_state")); err == nil {
+		a.state = state
+	}
+	if level, err := utils.ReadFile(path.Join(mdDir, "level")); err == nil && level != "" {
+		a.level = level
+	}
+	if raidDisks, err := utils.ReadFile(path.Join(mdDir, "raid_disks")); err == nil {
+		if v, err := strconv.Atoi(raidDisks); err == nil {
+			a.raidDisks = v
+		}
+	}
+	if degraded, err := utils.ReadFile(path.Join(mdDir, "degraded")); err == nil {
+		if v, err := strconv.Atoi(degraded); err == nil {
+			a.activeDisks = a.raidDisks - v
+		}
+	}
+	if action, err := utils.ReadFile(path.Join(mdDir, "sync_action")); err == nil {
+		a.syncAction = action
+	}
+	if completed, err := utils.ReadFile(path.Join(mdDir, "sync_completed")); err == nil {
+		// Either "none" or "<done> / <total>" in sectors
+		tokens := strings.Split(completed, "/")
+		if len(tokens) == 2 {
+			done, err1 := strconv.ParseFloat(strings.TrimSpace(tokens[0]), 64)
+			total, err2 := strconv.ParseFloat(strings.TrimSpace(tokens[1]), 64)
+			if err1 == nil && err2 == nil && total > 0 {
+				a.syncCompleted = done / total
+			}
+		}
+	}
+	if speed, err := utils.ReadFile(path.Join(mdDir, "sync_speed")); err == nil {
+		if v, err := strconv.ParseFloat(speed, 64); err == nil {
+			a.syncSpeed = v * 1024
+		}
+	}
+
+	for idx, m := range a.members {
+		state, err := utils.ReadFile(path.Join(mdDir, "dev-"+m.name, "state"))
+		if err != nil {
+			continue
+		}
+
+		switch {
+		case strings.Contains(state, "faulty"):
+			a.members[idx].state = "faulty"
+		case strings.Contains(state, "spare"):
+			a.members[idx].state = "spare"
+		case strings.Contains(state, "in_sync"):
+			a.members[idx].state = "active"
+		}
+	}
+}
+
+func getMdStatMetrics() ([]metric, error) {
+	content, err := utils.ReadFile(mdstatPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Ignore if the kernel does not support md
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	arrays := parseMdstat(content)
+	metrics := make([]metric, 0, len(arrays)*32)
+	for idx := range arrays {
+		readMdSysfs(blockDir, &arrays[idx])
+		metrics = append(metrics, mdArrayMetrics(&arrays[idx])...)
+	}
+
+	return metrics, nil
+}
+
+func mdArrayMetrics(a *mdArray) []metric {
+	attr := fmt.Sprintf("device=%q", a.name)
+	degraded := 0
+	if a.activeDisks < a.raidDisks {
+		degraded = 1
+	}
+
+	metrics := []metric{
+		{
+			name:       "node_md_array_info",
+			attr:       fmt.Sprintf("%s,level=%q", attr, a.level),
+			value:      1,
+			help:       "RAID level of the md array",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_md_array_size_bytes",
+			attr:       attr,
+			value:      a.sizeBytes,
+			help:       "Usable size of the md array in bytes",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_md_array_disks_required",
+			attr:       attr,
+			value:      float64(a.raidDisks),
+			help:       "Number of member devices the md array is configured with",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_md_array_degraded",
+			attr:       attr,
+			value:      float64(degraded),
+			help:       "Whether the md array is missing member devices",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_md_array_degraded_disks",
+			attr:       attr,
+			value:      float64(a.raidDisks - a.activeDisks),
+			help:       "Number of member devices missing from the md array",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_md_array_sync_completed_ratio",
+			attr:       attr,
+			value:      a.syncCompleted,
+			help:       "Progress of the current resync, recovery or check operation",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_md_array_sync_speed_bytes_per_second",
+			attr:       attr,
+			value:      a.syncSpeed,
+			help:       "Speed of the current resync, recovery or check operation",
+			metricType: "gauge",
+		},
+	}
+
+	for _, state := range mdMemberStates {
+		metrics = append(metrics, metric{
+			name:       "node_md_array_disks",
+			attr:       fmt.Sprintf("%s,state=%q", attr, state),
+			value:      float64(a.countMembers(state)),
+			help:       "Number of member devices of the md array in each state",
+			metricType: "gauge",
+		})
+	}
+
+	metrics = appendStateSetMetrics(metrics, "node_md_array_state", attr, "state", mdArrayStates, a.state, "State of the md array")
+	metrics = appendStateSetMetrics(metrics, "node_md_array_sync_action", attr, "action", mdSyncActions, a.syncAction, "Synchronization action currently running on the md array")
+
+	for _, m := range a.members {
+		memberAttr := fmt.Sprintf("%s,member=%q,slot=%q", attr, m.name, m.slot)
+		metrics = appendStateSetMetrics(metrics, "node_md_array_member_state", memberAttr, "state", mdMemberStates, m.state, "State of each member device of the md array")
+	}
+
+	return metrics
+}
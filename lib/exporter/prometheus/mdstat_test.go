@@ -0,0 +1,99 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMdstat(t *testing.T) {
+	arrays := parseMdstat(`Personalities : [linear] [raid0] [raid1] [raid10] [raid6] [raid5] [raid4] [multipath]
+md1 : active raid5 sda3[0] sdc3[2] sdd3[3](S) sdb3[1](F)
+      17551701504 blocks super 1.0 level 5, 512k chunk, algorithm 2 [3/2] [U_U]
+      [=>...................]  recovery =  8.5% (746197120/8775850752) finish=723.4min speed=184996K/sec
+      bitmap: 1/66 pages [4KB], 65536KB chunk
+
+md322 : active raid1 sdb5[3](S) sda5[2] sdc5[1]
+      7235136 blocks super 1.0 [2/2] [UU]
+      bitmap: 0/1 pages [0KB], 65536KB chunk
+
+md13 : active (auto-read-only) raid1 sda4[0] sdb4[1]
+      458880 blocks super 1.0 [32/2] [UU______________________________]
+      resync=DELAYED
+
+md2 : active raid0 sde3[0] sdf3[1]
+      1000000 blocks super 1.0 512k chunks
+
+unused devices: <none>`)
+
+	require.Len(t, arrays, 4)
+
+	assert.Equal(t, mdArray{
+		name:  "md1",
+		state: "active",
+		level: "raid5",
+		members: []mdMember{
+			{name: "sda3", slot: "0", state: "active"},
+			{name: "sdc3", slot: "2", state: "active"},
+			{name: "sdd3", slot: "3", state: "spare"},
+			{name: "sdb3", slot: "1", state: "faulty"},
+		},
+		raidDisks:     3,
+		activeDisks:   2,
+		sizeBytes:     17551701504 * 1024,
+		syncAction:    "recover",
+		syncCompleted: 0.085,
+		syncSpeed:     184996 * 1024,
+	}, arrays[0])
+
+	assert.Equal(t, "idle", arrays[1].syncAction)
+	assert.Equal(t, 1, arrays[1].countMembers("spare"))
+	assert.Equal(t, 2, arrays[1].activeDisks)
+
+	assert.Equal(t, "read-auto", arrays[2].state)
+	assert.Equal(t, "resync", arrays[2].syncAction)
+	assert.Equal(t, 32, arrays[2].raidDisks)
+
+	assert.Equal(t, "raid0", arrays[3].level)
+	assert.Equal(t, 2, arrays[3].raidDisks)
+	assert.Equal(t, 2, arrays[3].activeDisks)
+}
+
+func TestReadMdSysfs(t *testing.T) {
+	root := t.TempDir()
+	writeSysfsFile(t, root, "md1/md/array_state", "clean\n")
+	writeSysfsFile(t, root, "md1/md/level", "raid5\n")
+	writeSysfsFile(t, root, "md1/md/raid_disks", "3\n")
+	writeSysfsFile(t, root, "md1/md/degraded", "1\n")
+	writeSysfsFile(t, root, "md1/md/sync_action", "recover\n")
+	writeSysfsFile(t, root, "md1/md/sync_completed", "250 / 1000\n")
+	writeSysfsFile(t, root, "md1/md/sync_speed", "1000\n")
+	writeSysfsFile(t, root, "md1/md/dev-sdb3/state", "faulty,write_error\n")
+
+	a := mdArray{
+		name:    "md1",
+		members: []mdMember{{name: "sda3", slot: "0", state: "active"}, {name: "sdb3", slot: "1", state: "active"}},
+	}
+	readMdSysfs(root, &a)
+
+	assert.Equal(t, "clean", a.state)
+	assert.Equal(t, 3, a.raidDisks)
+	assert.Equal(t, 2, a.activeDisks)
+	assert.Equal(t, 0.25, a.syncCompleted)
+	assert.Equal(t, float64(1000*1024), a.syncSpeed)
+	assert.Equal(t, "faulty", a.members[1].state)
+
+	metrics := mdArrayMetrics(&a)
+	var degraded, faulty float64
+	for _, m := range metrics {
+		switch {
+		case m.name == "node_md_array_degraded":
+			degraded = m.value
+		case m.name == "node_md_array_disks" && m.attr == `device="md1",state="faulty"`:
+			faulty = m.value
+		}
+	}
+	assert.Equal(t, float64(1), degraded)
+	assert.Equal(t, float64(1), faulty)
+}
@@ -1,6 +1,9 @@
 package prometheus
 
-import "time"
+import (
+	"fmt"
+	"time"
+)
 
 type metric struct {
 	name       string
@@ -10,3 +13,23 @@ type metric struct {
 	help       string
 	metricType string
 }
+
+// appendStateSetMetrics appends one series per possible state, with a value of 1 for the current state
+func appendStateSetMetrics(metrics []metric, name, attr, label string, states []string, current, help string) []metric {
+	for _, state := range states {
+		var value float64
+		if state == current {
+			value = 1
+		}
+
+		metrics = append(metrics, metric{
+			name:       name,
+			attr:       fmt.Sprintf("%s,%s=%q", attr, label, state),
+			value:      value,
+			help:       help,
+			metricType: "gauge",
+		})
+	}
+
+	return metrics
+}
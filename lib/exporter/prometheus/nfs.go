@@ -0,0 +1,212 @@
+package prometheus
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pedropombeiro/qnapexporter/lib/utils"
+)
+
+const (
+	nfsdStatsPath  = "/proc/net/rpc/nfsd"
+	nfsdClientsDir = "/proc/fs/nfsd/clients"
+	nfsRmtabPath   = "/var/lib/nfs/rmtab"
+)
+
+var (
+	nfsClientAddressRe = regexp.MustCompile(`(?m)^address:\s*"?([^"\s]+)"?`)
+	nfsClientVersionRe = regexp.MustCompile(`(?m)^minor version:\s*(\d+)`)
+
+	// nfsdProcedures lists the NFS procedures counted in the procN lines of /proc/net/rpc/nfsd, in order
+	nfsdProcedures = map[string][]string{
+		"proc2": {
+			"null", "getattr", "setattr", "root", "lookup", "readlink", "read", "wrcache", "write", "create",
+			"remove", "rename", "link", "symlink", "mkdir", "rmdir", "readdir", "fsstat",
+		},
+		"proc3": {
+			"null", "getattr", "setattr", "lookup", "access", "readlink", "read", "write", "create", "mkdir",
+			"symlink", "mknod", "remove", "rmdir", "rename", "link", "readdir", "readdirplus", "fsstat", "fsinfo",
+			"pathconf", "commit",
+		},
+		// NFSv4 operations are indexed by their opcode, which starts at 3
+		"proc4ops": {
+			"", "", "", "access", "close", "commit", "create", "delegpurge", "delegreturn", "getattr",
+			"getfh", "link", "lock", "lockt", "locku", "lookup", "lookupp", "nverify", "open", "openattr",
+			"open_confirm", "open_downgrade", "putfh", "putpubfh", "putrootfh", "read", "readdir", "readlink", "remove", "rename",
+			"renew", "restorefh", "savefh", "secinfo", "setattr", "setclientid", "setclientid_confirm", "verify", "write", "release_lockowner",
+			"backchannel_ctl", "bind_conn_to_session", "exchange_id", "create_session", "destroy_session", "free_stateid", "get_dir_delegation", "getdeviceinfo", "getdevicelist", "layoutcommit",
+			"layoutget", "layoutreturn", "secinfo_no_name", "sequence", "set_ssv", "test_stateid", "want_delegation", "destroy_clientid", "reclaim_complete", "allocate",
+			"copy", "copy_notify", "deallocate", "io_advise", "layouterror", "layoutstats", "offload_cancel", "offload_status", "read_plus", "seek",
+			"write_same", "clone", "getxattr", "setxattr", "listxattrs", "removexattr",
+		},
+	}
+	nfsdProcedureVersions = map[string]string{"proc2": "2", "proc3": "3", "proc4ops": "4"}
+)
+
+// nfsdStats holds the NFS server counters from /proc/net/rpc/nfsd
+type nfsdStats struct {
+	readBytes    float64
+	writtenBytes float64
+	rpcCalls     float64
+	rpcBadCalls  float64
+	// procedures counts the calls to each procedure, keyed by NFS version and procedure name
+	procedures map[[2]string]float64
+}
+
+// nfsClient is an NFS client known to the server, with the export it mounted when known (NFSv3)
+type nfsClient struct {
+	address string
+	version string
+	export  string
+}
+
+// parseNfsdStats parses the contents of /proc/net/rpc/nfsd
+func parseNfsdStats(content string) nfsdStats {
+	stats := nfsdStats{procedures: make(map[[2]string]float64)}
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		values := make([]float64, 0, len(fields)-1)
+		for _, f := range fields[1:] {
+			v, _ := strconv.ParseFloat(f, 64)
+			values = append(values, v)
+		}
+
+		switch fields[0] {
+		case "io":
+			stats.readBytes = values[0]
+			if len(values) > 1 {
+				stats.writtenBytes = values[1]
+			}
+		case "rpc":
+			stats.rpcCalls = values[0]
+			if len(values) > 1 {
+				stats.rpcBadCalls = values[1]
+			}
+		case "proc2", "proc3", "proc4ops":
+			// The first value is the number of counters that follow
+			names := nfsdProcedures[fields[0]]
+			version := nfsdProcedureVersions[fields[0]]
+			for idx, v := range values[1:] {
+				name := fmt.Sprintf("op%d", idx)
+				if idx < len(names) {
+					name = names[idx]
+				}
+				if name == "" {
+					continue
+				}
+				stats.procedures[[2]string{version, name}] = v
+			}
+		}
+	}
+
+	return stats
+}
+
+// readNfsClients lists the NFSv4 clients with state on the server, and the NFSv3 clients that mounted an export
+func readNfsClients(clientsDir, rmtabPath string) []nfsClient {
+	var clients []nfsClient
+
+	infos, _ := filepath.Glob(path.Join(clientsDir, "*", "info"))
+	for _, info := range infos {
+		content, err := utils.ReadFile(info)
+		if err != nil {
+			continue
+		}
+
+		matches := nfsClientAddressRe.FindStringSubmatch(content)
+		if matches == nil {
+			continue
+		}
+		client := nfsClient{address: stripPort(matches[1]), version: "4"}
+		if v := nfsClientVersionRe.FindStringSubmatch(content); v != nil {
+			client.version = "4." + v[1]
+		}
+		clients = append(clients, client)
+	}
+
+	// rmtab lists one <host>:<export>:<count> entry per mount
+	lines, _ := utils.ReadFileLines(rmtabPath)
+	for _, line := range lines {
+		tokens := strings.Split(strings.TrimSpace(line), ":")
+		if len(tokens) < 2 || tokens[0] == "" {
+			continue
+		}
+		clients = append(clients, nfsClient{address: tokens[0], version: "3", export: tokens[1]})
+	}
+
+	return clients
+}
+
+func stripPort(address string) string {
+	if idx := strings.LastIndex(address, ":"); idx > 0 && !strings.HasSuffix(address, "]") {
+		address = address[:idx]
+	}
+
+	return strings.Trim(address, "[]")
+}
+
+func getNfsMetrics() ([]metric, error) {
+	content, err := utils.ReadFile(nfsdStatsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// Ignore if the NFS server is not running
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	metrics := nfsdMetrics(parseNfsdStats(content))
+	return appendNfsClientMetrics(metrics, readNfsClients(nfsdClientsDir, nfsRmtabPath)), nil
+}
+
+func nfsdMetrics(s nfsdStats) []metric {
+	metrics := []metric{
+		{name: "node_nfsd_read_bytes_total", value: s.readBytes, help: "Number of bytes read by NFS clients", metricType: "counter"},
+		{name: "node_nfsd_written_bytes_total", value: s.writtenBytes, help: "Number of bytes written by NFS clients", metricType: "counter"},
+		{name: "node_nfsd_rpc_calls_total", value: s.rpcCalls, help: "Number of RPC calls received by the NFS server", metricType: "counter"},
+		{name: "node_nfsd_rpc_bad_calls_total", value: s.rpcBadCalls, help: "Number of invalid RPC calls received by the NFS server", metricType: "counter"},
+	}
+
+	procedures := make([][2]string, 0, len(s.procedures))
+	for key := range s.procedures {
+		procedures = append(procedures, key)
+	}
+	sort.Slice(procedures, func(i, j int) bool {
+		if procedures[i][0] != procedures[j][0] {
+			return procedures[i][0] < procedures[j][0]
+		}
+		return procedures[i][1] < procedures[j][1]
+	})
+
+	for _, key := range procedures {
+		metrics = append(metrics, metric{
+			name:       "node_nfsd_procedure_requests_total",
+			attr:       fmt.Sprintf("version=%q,procedure=%q", key[0], key[1]),
+			value:      s.procedures[key],
+			help:       "Number of NFS requests received per procedure",
+			metricType: "counter",
+		})
+	}
+
+	return metrics
+}
+
+func appendNfsClientMetrics(metrics []metric, clients []nfsClient) []metric {
+	counts := make(map[string]int, len(clients))
+	for _, c := range clients {
+		counts[fmt.Sprintf("client=%q,version=%q,export=%q", c.address, c.version, c.export)]++
+	}
+
+	return appendCountMetrics(metrics, "node_nfs_clients", counts, "NFS clients connected to the server")
+}
@@ -0,0 +1,56 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNfsdStats(t *testing.T) {
+	stats := parseNfsdStats(`rc 0 4261 10213
+fh 0 0 0 0 0
+io 1073741824 536870912
+th 8 0 0.000 0.000 0.000 0.000 0.000 0.000 0.000 0.000 0.000 0.000
+ra 32 0 0 0 0 0 0 0 0 0 0 0
+net 14474 0 14474 2
+rpc 14474 3 0 0 0
+proc3 22 2 100 0 50 25 0 30 40 0 0 0 0 0 0 0 0 0 10 0 0 0 5
+proc4 2 1 12
+proc4ops 76 0 0 0 7 0 0 0 0 0 9 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0
+`)
+
+	assert.Equal(t, 1073741824.0, stats.readBytes)
+	assert.Equal(t, 536870912.0, stats.writtenBytes)
+	assert.Equal(t, 14474.0, stats.rpcCalls)
+	assert.Equal(t, 3.0, stats.rpcBadCalls)
+	assert.Equal(t, 100.0, stats.procedures[[2]string{"3", "getattr"}])
+	assert.Equal(t, 30.0, stats.procedures[[2]string{"3", "read"}])
+	assert.Equal(t, 10.0, stats.procedures[[2]string{"3", "readdirplus"}])
+	assert.Equal(t, 5.0, stats.procedures[[2]string{"3", "commit"}])
+	assert.Equal(t, 7.0, stats.procedures[[2]string{"4", "access"}])
+	assert.Equal(t, 9.0, stats.procedures[[2]string{"4", "getattr"}])
+	assert.Len(t, stats.procedures, 22+73)
+}
+
+func TestReadNfsClients(t *testing.T) {
+	root := t.TempDir()
+	writeSysfsFile(t, root, "clients/5/info", "clientid: 0x6a2b1c3d4e5f6071\naddress: \"192.168.1.20:881\"\nstatus: confirmed\nname: \"Linux NFSv4.2 host\"\nminor version: 2\n")
+	writeSysfsFile(t, root, "rmtab", "192.168.1.30:/share/Backup:0x00000001\n192.168.1.31:/share/Media:0x00000002\n")
+
+	clients := readNfsClients(root+"/clients", root+"/rmtab")
+
+	assert.Equal(t, []nfsClient{
+		{address: "192.168.1.20", version: "4.2"},
+		{address: "192.168.1.30", version: "3", export: "/share/Backup"},
+		{address: "192.168.1.31", version: "3", export: "/share/Media"},
+	}, clients)
+
+	metrics := appendNfsClientMetrics(nil, clients)
+	assert.Len(t, metrics, 3)
+	assert.Equal(t, `client="192.168.1.20",version="4.2",export=""`, metrics[0].attr)
+}
+
+func TestStripPort(t *testing.T) {
+	assert.Equal(t, "192.168.1.20", stripPort("192.168.1.20:881"))
+	assert.Equal(t, "fe80::1", stripPort("[fe80::1]:881"))
+}
@@ -1,99 +1,261 @@
 package prometheus
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/pedropombeiro/qnapexporter/lib/utils"
 )
 
-// Regular expressions for parsing nvme smart-log output
-var (
-	nvmeTemperatureRe     = regexp.MustCompile(`(?m)^temperature\s*:\s*(\d+)\s*C`)
-	nvmeAvailableSpareRe  = regexp.MustCompile(`(?m)^available_spare\s*:\s*(\d+)%`)
-	nvmeSpareThresholdRe  = regexp.MustCompile(`(?m)^available_spare_threshold\s*:\s*(\d+)%`)
-	nvmePercentageUsedRe  = regexp.MustCompile(`(?m)^percentage_used\s*:\s*(\d+)%`)
-	nvmePowerOnHoursRe    = regexp.MustCompile(`(?m)^power_on_hours\s*:\s*([\d,]+)`)
-	nvmePowerCyclesRe     = regexp.MustCompile(`(?m)^power_cycles\s*:\s*([\d,]+)`)
-	nvmeUnsafeShutdownsRe = regexp.MustCompile(`(?m)^unsafe_shutdowns\s*:\s*([\d,]+)`)
-	nvmeMediaErrorsRe     = regexp.MustCompile(`(?m)^media_errors\s*:\s*([\d,]+)`)
+const (
+	// nvmeDataUnitBytes is the size of a SMART data unit (1000 units of 512 bytes)
+	nvmeDataUnitBytes = 1000 * 512
+	// nvmeKelvinOffset mirrors the Kelvin to Celsius conversion done by nvme-cli
+	nvmeKelvinOffset = 273
 )
 
+// nvmeCriticalWarningBits names each bit of the SMART critical_warning field
+var nvmeCriticalWarningBits = []string{
+	"available_spare",
+	"temperature_threshold",
+	"reliability_degraded",
+	"read_only",
+	"volatile_memory_backup_failed",
+	"persistent_memory_region_read_only",
+}
+
 // nvmeSmartData holds parsed SMART log data for an NVMe device
 type nvmeSmartData struct {
+	CriticalWarning         float64
 	Temperature             float64
 	AvailableSpare          float64
 	AvailableSpareThreshold float64
 	PercentageUsed          float64
+	DataReadBytes           float64
+	DataWrittenBytes        float64
+	HostReadCommands        float64
+	HostWriteCommands       float64
+	ControllerBusyMinutes   float64
 	PowerOnHours            float64
 	PowerCycles             float64
 	UnsafeShutdowns         float64
 	MediaErrors             float64
+	ErrorLogEntries         float64
+	WarningTempMinutes      float64
+	CriticalTempMinutes     float64
+	// TemperatureSensors maps the sensor number to its temperature in Celsius
+	TemperatureSensors map[int]float64
+	// ThermalTransitions and ThermalTimeSeconds map the thermal management level (1 or 2) to its counters
+	ThermalTransitions map[int]float64
+	ThermalTimeSeconds map[int]float64
 }
 
-// parseNvmeSmartLog parses the output of `nvme smart-log` command
-func parseNvmeSmartLog(output string) (*nvmeSmartData, error) {
-	data := &nvmeSmartData{}
+// nvmeControllerInfo holds the identification data reported by `nvme id-ctrl`
+type nvmeControllerInfo struct {
+	Model    string
+	Serial   string
+	Firmware string
+}
 
-	// Parse temperature
-	if matches := nvmeTemperatureRe.FindStringSubmatch(output); len(matches) >= 2 {
-		if val, err := strconv.ParseFloat(matches[1], 64); err == nil {
-			data.Temperature = val
-		}
+func newNvmeSmartData() *nvmeSmartData {
+	return &nvmeSmartData{
+		TemperatureSensors: map[int]float64{},
+		ThermalTransitions: map[int]float64{},
+		ThermalTimeSeconds: map[int]float64{},
 	}
+}
 
-	// Parse available spare (convert percentage to ratio)
-	if matches := nvmeAvailableSpareRe.FindStringSubmatch(output); len(matches) >= 2 {
-		if val, err := strconv.ParseFloat(matches[1], 64); err == nil {
-			data.AvailableSpare = val / 100.0
+// set assigns a SMART field identified by its JSON key (or normalized text key).
+// Temperatures are expected in Celsius and percentages in the 0-100 range.
+func (d *nvmeSmartData) set(key string, value float64) {
+	switch key {
+	case "critical_warning":
+		d.CriticalWarning = value
+	case "temperature":
+		d.Temperature = value
+	case "avail_spare", "available_spare":
+		d.AvailableSpare = value / 100.0
+	case "spare_thresh", "available_spare_threshold":
+		d.AvailableSpareThreshold = value / 100.0
+	case "percent_used", "percentage_used":
+		d.PercentageUsed = value / 100.0
+	case "data_units_read":
+		d.DataReadBytes = value * nvmeDataUnitBytes
+	case "data_units_written":
+		d.DataWrittenBytes = value * nvmeDataUnitBytes
+	case "host_read_commands":
+		d.HostReadCommands = value
+	case "host_write_commands":
+		d.HostWriteCommands = value
+	case "controller_busy_time":
+		d.ControllerBusyMinutes = value
+	case "power_on_hours":
+		d.PowerOnHours = value
+	case "power_cycles":
+		d.PowerCycles = value
+	case "unsafe_shutdowns":
+		d.UnsafeShutdowns = value
+	case "media_errors":
+		d.MediaErrors = value
+	case "num_err_log_entries":
+		d.ErrorLogEntries = value
+	case "warning_temp_time", "warning_temperature_time":
+		d.WarningTempMinutes = value
+	case "critical_comp_time", "critical_composite_temperature_time":
+		d.CriticalTempMinutes = value
+	default:
+		var n int
+		switch {
+		case scanSuffixInt(key, "temperature_sensor_", &n):
+			d.TemperatureSensors[n] = value
+		case scanSuffixInt(key, "thm_temp", &n) && strings.HasSuffix(key, "_trans_count"):
+			d.ThermalTransitions[n] = value
+		case scanSuffixInt(key, "thm_temp", &n) && strings.HasSuffix(key, "_total_time"):
+			d.ThermalTimeSeconds[n] = value
+		case scanSuffixInt(key, "thermal_management_t", &n) && strings.HasSuffix(key, "_trans_count"):
+			d.ThermalTransitions[n] = value
+		case scanSuffixInt(key, "thermal_management_t", &n) && strings.HasSuffix(key, "_total_time"):
+			d.ThermalTimeSeconds[n] = value
 		}
 	}
+}
 
-	// Parse available spare threshold (convert percentage to ratio)
-	if matches := nvmeSpareThresholdRe.FindStringSubmatch(output); len(matches) >= 2 {
-		if val, err := strconv.ParseFloat(matches[1], 64); err == nil {
-			data.AvailableSpareThreshold = val / 100.0
-		}
+// scanSuffixInt parses the integer immediately following prefix in key
+func scanSuffixInt(key, prefix string, n *int) bool {
+	if !strings.HasPrefix(key, prefix) {
+		return false
 	}
 
-	// Parse percentage used (convert percentage to ratio)
-	if matches := nvmePercentageUsedRe.FindStringSubmatch(output); len(matches) >= 2 {
-		if val, err := strconv.ParseFloat(matches[1], 64); err == nil {
-			data.PercentageUsed = val / 100.0
-		}
+	digits := key[len(prefix):]
+	if idx := strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' }); idx >= 0 {
+		digits = digits[:idx]
 	}
 
-	// Parse power on hours (remove commas from number)
-	if matches := nvmePowerOnHoursRe.FindStringSubmatch(output); len(matches) >= 2 {
-		if val, err := parseNumberWithCommas(matches[1]); err == nil {
-			data.PowerOnHours = val
+	v, err := strconv.Atoi(digits)
+	if err != nil {
+		return false
+	}
+
+	*n = v
+	return true
+}
+
+// parseNvmeSmartLogJSON parses the output of `nvme smart-log -o json`
+func parseNvmeSmartLogJSON(output string) (*nvmeSmartData, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(output), &fields); err != nil {
+		return nil, fmt.Errorf("parse nvme smart-log JSON: %w", err)
+	}
+
+	data := newNvmeSmartData()
+	for key, raw := range fields {
+		value, err := parseNvmeJSONValue(raw)
+		if err != nil {
+			continue
+		}
+
+		if key == "temperature" || strings.HasPrefix(key, "temperature_sensor_") {
+			// Temperatures are reported in Kelvin
+			value -= nvmeKelvinOffset
 		}
+		data.set(key, value)
 	}
 
-	// Parse power cycles
-	if matches := nvmePowerCyclesRe.FindStringSubmatch(output); len(matches) >= 2 {
-		if val, err := parseNumberWithCommas(matches[1]); err == nil {
-			data.PowerCycles = val
+	return data, nil
+}
+
+// parseNvmeJSONValue parses a SMART JSON value, which depending on the nvme-cli version
+// may be a number, a string (for 128-bit counters), or an object with a "value" field
+func parseNvmeJSONValue(raw json.RawMessage) (float64, error) {
+	var f float64
+	if err := json.Unmarshal(raw, &f); err == nil {
+		return f, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return parseNumberWithCommas(s)
+	}
+
+	var obj struct {
+		Value *float64 `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &obj); err == nil && obj.Value != nil {
+		return *obj.Value, nil
+	}
+
+	return 0, errors.New("unsupported value")
+}
+
+// parseNvmeSmartLog parses the human-readable output of `nvme smart-log` command
+func parseNvmeSmartLog(output string) (*nvmeSmartData, error) {
+	data := newNvmeSmartData()
+
+	for key, value := range parseNvmeTextFields(output) {
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+
+		val, err := parseNumberWithCommas(strings.TrimRight(fields[0], "%"))
+		if err != nil {
+			// Some nvme-cli versions print bit fields in hexadecimal
+			hex, hexErr := strconv.ParseInt(fields[0], 0, 64)
+			if hexErr != nil {
+				continue
+			}
+			val = float64(hex)
 		}
+
+		data.set(key, val)
 	}
 
-	// Parse unsafe shutdowns
-	if matches := nvmeUnsafeShutdownsRe.FindStringSubmatch(output); len(matches) >= 2 {
-		if val, err := parseNumberWithCommas(matches[1]); err == nil {
-			data.UnsafeShutdowns = val
+	return data, nil
+}
+
+// parseNvmeTextFields splits `key : value` lines, normalizing keys to lower-case snake case
+func parseNvmeTextFields(output string) map[string]string {
+	fields := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		tokens := strings.SplitN(line, ":", 2)
+		if len(tokens) < 2 {
+			continue
 		}
+
+		key := strings.ToLower(strings.Join(strings.Fields(tokens[0]), "_"))
+		if key == "" {
+			continue
+		}
+		fields[key] = strings.TrimSpace(tokens[1])
 	}
 
-	// Parse media errors
-	if matches := nvmeMediaErrorsRe.FindStringSubmatch(output); len(matches) >= 2 {
-		if val, err := parseNumberWithCommas(matches[1]); err == nil {
-			data.MediaErrors = val
+	return fields
+}
+
+// parseNvmeIDCtrl parses the output of `nvme id-ctrl`, in either JSON or text format
+func parseNvmeIDCtrl(output string) nvmeControllerInfo {
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(output), &fields); err != nil {
+		fields = make(map[string]any)
+		for k, v := range parseNvmeTextFields(output) {
+			fields[k] = v
 		}
 	}
 
-	return data, nil
+	str := func(key string) string {
+		s, _ := fields[key].(string)
+		return strings.TrimSpace(s)
+	}
+
+	return nvmeControllerInfo{
+		Model:    str("mn"),
+		Serial:   str("sn"),
+		Firmware: str("fr"),
+	}
 }
 
 // parseNumberWithCommas parses a number string that may contain commas as thousand separators
@@ -102,104 +264,255 @@ func parseNumberWithCommas(s string) (float64, error) {
 	return strconv.ParseFloat(s, 64)
 }
 
+// readNvmeControllers retrieves the identification data of each NVMe controller
+func (e *promExporter) readNvmeControllers() {
+	e.nvmeControllers = make(map[string]nvmeControllerInfo, len(e.nvmeDevices))
+	if e.nvmePath == "" {
+		return
+	}
+
+	for _, device := range e.nvmeDevices {
+		devicePath := fmt.Sprintf("/dev/%s", device)
+		output, err := utils.ExecCommand(e.nvmePath, "id-ctrl", "-o", "json", devicePath)
+		if err != nil {
+			output, err = utils.ExecCommand(e.nvmePath, "id-ctrl", devicePath)
+		}
+		if err != nil {
+			e.Logger.Printf("Failed to get NVMe controller data for %s: %v", device, err)
+			continue
+		}
+
+		e.nvmeControllers[device] = parseNvmeIDCtrl(output)
+	}
+	e.Logger.Printf("Found NVMe controllers: %v", e.nvmeControllers)
+}
+
+// readNvmeSmartLog runs `nvme smart-log`, preferring JSON output and falling back to text
+func (e *promExporter) readNvmeSmartLog(device string) (*nvmeSmartData, error) {
+	devicePath := fmt.Sprintf("/dev/%s", device)
+	output, err := utils.ExecCommand(e.nvmePath, "smart-log", "-o", "json", devicePath)
+	if err == nil {
+		data, err := parseNvmeSmartLogJSON(output)
+		if err == nil {
+			return data, nil
+		}
+	}
+
+	output, err = utils.ExecCommand(e.nvmePath, "smart-log", devicePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseNvmeSmartLog(output)
+}
+
 // getNvmeSmartMetrics retrieves SMART metrics for all NVMe devices
 func (e *promExporter) getNvmeSmartMetrics() ([]metric, error) {
 	if e.nvmePath == "" || len(e.nvmeDevices) == 0 {
 		return nil, nil
 	}
 
-	// Pre-allocate space for metrics (8 metrics per device)
-	metrics := make([]metric, 0, len(e.nvmeDevices)*8)
+	metrics := make([]metric, 0, len(e.nvmeDevices)*32)
 
 	for _, device := range e.nvmeDevices {
-		devicePath := fmt.Sprintf("/dev/%s", device)
-		output, err := utils.ExecCommand(e.nvmePath, "smart-log", devicePath)
+		data, err := e.readNvmeSmartLog(device)
 		if err != nil {
 			// Log the error but continue with other devices
 			e.Logger.Printf("Failed to get NVMe SMART data for %s: %v", device, err)
 			continue
 		}
 
-		data, err := parseNvmeSmartLog(output)
-		if err != nil {
-			e.Logger.Printf("Failed to parse NVMe SMART data for %s: %v", device, err)
-			continue
+		attr := fmt.Sprintf(`device=%q`, device)
+
+		if info, ok := e.nvmeControllers[device]; ok {
+			metrics = append(metrics, metric{
+				name:       "node_nvme_info",
+				attr:       fmt.Sprintf(`%s,model=%q,serial=%q,firmware=%q`, attr, info.Model, info.Serial, info.Firmware),
+				value:      1,
+				help:       "Identification data of the NVMe controller",
+				metricType: "gauge",
+			})
 		}
 
-		attr := fmt.Sprintf(`device=%q`, device)
+		metrics = append(metrics, nvmeSmartMetrics(attr, data)...)
+	}
 
-		// Temperature
-		metrics = append(metrics, metric{
+	return metrics, nil
+}
+
+func nvmeSmartMetrics(attr string, data *nvmeSmartData) []metric {
+	metrics := []metric{
+		{
+			name:       "node_nvme_critical_warning",
+			attr:       attr,
+			value:      data.CriticalWarning,
+			help:       "Raw value of the critical warning field of the SMART log",
+			metricType: "gauge",
+		},
+		{
 			name:       "node_nvme_temperature_celsius",
 			attr:       attr,
 			value:      data.Temperature,
 			help:       "Current temperature of the NVMe device in Celsius",
 			metricType: "gauge",
-		})
-
-		// Available spare
-		metrics = append(metrics, metric{
+		},
+		{
 			name:       "node_nvme_available_spare_ratio",
 			attr:       attr,
 			value:      data.AvailableSpare,
 			help:       "Normalized percentage of remaining spare capacity available",
 			metricType: "gauge",
-		})
-
-		// Available spare threshold
-		metrics = append(metrics, metric{
+		},
+		{
 			name:       "node_nvme_available_spare_threshold_ratio",
 			attr:       attr,
 			value:      data.AvailableSpareThreshold,
 			help:       "Threshold at which spare capacity is considered critically low",
 			metricType: "gauge",
-		})
-
-		// Percentage used
-		metrics = append(metrics, metric{
+		},
+		{
 			name:       "node_nvme_percentage_used_ratio",
 			attr:       attr,
 			value:      data.PercentageUsed,
 			help:       "Vendor-specific estimate of the percentage of NVMe subsystem life used",
 			metricType: "gauge",
-		})
-
-		// Power on hours
-		metrics = append(metrics, metric{
+		},
+		{
+			name:       "node_nvme_data_read_bytes_total",
+			attr:       attr,
+			value:      data.DataReadBytes,
+			help:       "Total number of bytes read by the host",
+			metricType: "counter",
+		},
+		{
+			name:       "node_nvme_data_written_bytes_total",
+			attr:       attr,
+			value:      data.DataWrittenBytes,
+			help:       "Total number of bytes written by the host",
+			metricType: "counter",
+		},
+		{
+			name:       "node_nvme_host_read_commands_total",
+			attr:       attr,
+			value:      data.HostReadCommands,
+			help:       "Total number of read commands completed by the controller",
+			metricType: "counter",
+		},
+		{
+			name:       "node_nvme_host_write_commands_total",
+			attr:       attr,
+			value:      data.HostWriteCommands,
+			help:       "Total number of write commands completed by the controller",
+			metricType: "counter",
+		},
+		{
+			name:       "node_nvme_controller_busy_time_seconds_total",
+			attr:       attr,
+			value:      data.ControllerBusyMinutes * 60,
+			help:       "Total time the controller was busy with I/O commands",
+			metricType: "counter",
+		},
+		{
 			name:       "node_nvme_power_on_hours_total",
 			attr:       attr,
 			value:      data.PowerOnHours,
 			help:       "Total number of power-on hours",
 			metricType: "counter",
-		})
-
-		// Power cycles
-		metrics = append(metrics, metric{
+		},
+		{
 			name:       "node_nvme_power_cycles_total",
 			attr:       attr,
 			value:      data.PowerCycles,
 			help:       "Total number of power cycles",
 			metricType: "counter",
-		})
-
-		// Unsafe shutdowns
-		metrics = append(metrics, metric{
+		},
+		{
 			name:       "node_nvme_unsafe_shutdowns_total",
 			attr:       attr,
 			value:      data.UnsafeShutdowns,
 			help:       "Total number of unsafe shutdowns",
 			metricType: "counter",
-		})
-
-		// Media errors
-		metrics = append(metrics, metric{
+		},
+		{
 			name:       "node_nvme_media_errors_total",
 			attr:       attr,
 			value:      data.MediaErrors,
 			help:       "Total number of unrecovered data integrity errors",
 			metricType: "counter",
+		},
+		{
+			name:       "node_nvme_error_log_entries_total",
+			attr:       attr,
+			value:      data.ErrorLogEntries,
+			help:       "Total number of error information log entries over the life of the controller",
+			metricType: "counter",
+		},
+		{
+			name:       "node_nvme_warning_temperature_time_seconds_total",
+			attr:       attr,
+			value:      data.WarningTempMinutes * 60,
+			help:       "Total time the composite temperature was above the warning threshold",
+			metricType: "counter",
+		},
+		{
+			name:       "node_nvme_critical_temperature_time_seconds_total",
+			attr:       attr,
+			value:      data.CriticalTempMinutes * 60,
+			help:       "Total time the composite temperature was above the critical threshold",
+			metricType: "counter",
+		},
+	}
+
+	warning := int(data.CriticalWarning)
+	for bit, name := range nvmeCriticalWarningBits {
+		metrics = append(metrics, metric{
+			name:       "node_nvme_critical_warning_active",
+			attr:       fmt.Sprintf(`%s,warning=%q`, attr, name),
+			value:      float64((warning >> bit) & 1),
+			help:       "Whether each critical warning condition of the SMART log is active",
+			metricType: "gauge",
 		})
 	}
 
-	return metrics, nil
+	for _, sensor := range sortedKeys(data.TemperatureSensors) {
+		metrics = append(metrics, metric{
+			name:       "node_nvme_temperature_sensor_celsius",
+			attr:       fmt.Sprintf(`%s,sensor="%d"`, attr, sensor),
+			value:      data.TemperatureSensors[sensor],
+			help:       "Current temperature reported by each NVMe temperature sensor in Celsius",
+			metricType: "gauge",
+		})
+	}
+
+	for _, level := range sortedKeys(data.ThermalTransitions) {
+		metrics = append(metrics, metric{
+			name:       "node_nvme_thermal_management_transitions_total",
+			attr:       fmt.Sprintf(`%s,level="%d"`, attr, level),
+			value:      data.ThermalTransitions[level],
+			help:       "Number of times the controller transitioned to a thermal management level",
+			metricType: "counter",
+		})
+	}
+
+	for _, level := range sortedKeys(data.ThermalTimeSeconds) {
+		metrics = append(metrics, metric{
+			name:       "node_nvme_thermal_management_time_seconds_total",
+			attr:       fmt.Sprintf(`%s,level="%d"`, attr, level),
+			value:      data.ThermalTimeSeconds[level],
+			help:       "Total time the controller spent in a thermal management level",
+			metricType: "counter",
+		})
+	}
+
+	return metrics
+}
+
+func sortedKeys(m map[int]float64) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+
+	return keys
 }
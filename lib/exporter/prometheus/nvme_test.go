@@ -151,3 +151,143 @@ func TestParseNumberWithCommas(t *testing.T) {
 		})
 	}
 }
+
+func TestParseNvmeSmartLogAllFields(t *testing.T) {
+	textInput := `Smart Log for NVME device:nvme0 namespace-id:ffffffff
+critical_warning			: 0x5
+temperature				: 33 °C (306 K)
+available_spare				: 100%
+available_spare_threshold		: 10%
+percentage_used				: 2%
+endurance group critical warning summary: 0
+Data Units Read				: 2,462,876 (1.26 TB)
+Data Units Written			: 3297914 (1.69 TB)
+host_read_commands			: 23599614
+host_write_commands			: 43787364
+controller_busy_time			: 101
+power_cycles				: 68
+power_on_hours				: 1084
+unsafe_shutdowns			: 28
+media_errors				: 0
+num_err_log_entries			: 7
+Warning Temperature Time		: 3
+Critical Composite Temperature Time	: 1
+Temperature Sensor 1           : 33 °C (306 K)
+Temperature Sensor 2           : 40 °C (313 K)
+Thermal Management T1 Trans Count	: 4
+Thermal Management T2 Trans Count	: 0
+Thermal Management T1 Total Time	: 120
+Thermal Management T2 Total Time	: 0`
+
+	jsonInput := `{
+  "critical_warning":{"value":5,"available_spare":1,"temp_threshold":0,"reliability_degraded":1},
+  "temperature":306,
+  "avail_spare":100,
+  "spare_thresh":10,
+  "percent_used":2,
+  "endurance_grp_critical_warning_summary":0,
+  "data_units_read":"2462876",
+  "data_units_written":3297914,
+  "host_read_commands":23599614,
+  "host_write_commands":43787364,
+  "controller_busy_time":101,
+  "power_cycles":68,
+  "power_on_hours":1084,
+  "unsafe_shutdowns":28,
+  "media_errors":0,
+  "num_err_log_entries":7,
+  "warning_temp_time":3,
+  "critical_comp_time":1,
+  "temperature_sensor_1":306,
+  "temperature_sensor_2":313,
+  "thm_temp1_trans_count":4,
+  "thm_temp2_trans_count":0,
+  "thm_temp1_total_time":120,
+  "thm_temp2_total_time":0
+}`
+
+	expected := &nvmeSmartData{
+		CriticalWarning:         5,
+		Temperature:             33,
+		AvailableSpare:          1.0,
+		AvailableSpareThreshold: 0.10,
+		PercentageUsed:          0.02,
+		DataReadBytes:           2462876 * 512000,
+		DataWrittenBytes:        3297914 * 512000,
+		HostReadCommands:        23599614,
+		HostWriteCommands:       43787364,
+		ControllerBusyMinutes:   101,
+		PowerOnHours:            1084,
+		PowerCycles:             68,
+		UnsafeShutdowns:         28,
+		MediaErrors:             0,
+		ErrorLogEntries:         7,
+		WarningTempMinutes:      3,
+		CriticalTempMinutes:     1,
+		TemperatureSensors:      map[int]float64{1: 33, 2: 40},
+		ThermalTransitions:      map[int]float64{1: 4, 2: 0},
+		ThermalTimeSeconds:      map[int]float64{1: 120, 2: 0},
+	}
+
+	t.Run("text", func(t *testing.T) {
+		result, err := parseNvmeSmartLog(textInput)
+		require.NoError(t, err)
+		assert.Equal(t, expected, result)
+	})
+
+	t.Run("json", func(t *testing.T) {
+		result, err := parseNvmeSmartLogJSON(jsonInput)
+		require.NoError(t, err)
+		assert.Equal(t, expected, result)
+	})
+
+	t.Run("invalid json", func(t *testing.T) {
+		_, err := parseNvmeSmartLogJSON(textInput)
+		require.Error(t, err)
+	})
+}
+
+func TestNvmeSmartMetricsCriticalWarningBits(t *testing.T) {
+	data := newNvmeSmartData()
+	data.CriticalWarning = 5
+
+	active := map[string]float64{}
+	for _, m := range nvmeSmartMetrics(`device="nvme0"`, data) {
+		if m.name == "node_nvme_critical_warning_active" {
+			active[m.attr] = m.value
+		}
+	}
+
+	assert.Equal(t, map[string]float64{
+		`device="nvme0",warning="available_spare"`:                    1,
+		`device="nvme0",warning="temperature_threshold"`:              0,
+		`device="nvme0",warning="reliability_degraded"`:               1,
+		`device="nvme0",warning="read_only"`:                          0,
+		`device="nvme0",warning="volatile_memory_backup_failed"`:      0,
+		`device="nvme0",warning="persistent_memory_region_read_only"`: 0,
+	}, active)
+}
+
+func TestParseNvmeIDCtrl(t *testing.T) {
+	expected := nvmeControllerInfo{
+		Model:    "Samsung SSD 970 EVO Plus 1TB",
+		Serial:   "S4EWNX0R123456",
+		Firmware: "2B2QEXM7",
+	}
+
+	t.Run("json", func(t *testing.T) {
+		info := parseNvmeIDCtrl(`{"vid":5197,"ssvid":5197,"sn":"S4EWNX0R123456      ","mn":"Samsung SSD 970 EVO Plus 1TB            ","fr":"2B2QEXM7","rab":2}`)
+		assert.Equal(t, expected, info)
+	})
+
+	t.Run("text", func(t *testing.T) {
+		info := parseNvmeIDCtrl(`NVME Identify Controller:
+vid       : 0x144d
+ssvid     : 0x144d
+sn        : S4EWNX0R123456
+mn        : Samsung SSD 970 EVO Plus 1TB
+fr        : 2B2QEXM7
+rab       : 2`)
+		assert.Equal(t, expected, info)
+	})
+}
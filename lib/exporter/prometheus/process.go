@@ -0,0 +1,315 @@
+package prometheus
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+// qpkgExeRe matches the executables installed by a QPKG, e.g. /share/CACHEDEV1_DATA/.qpkg/PlexMediaServer/Plex Media Server
+var qpkgExeRe = regexp.MustCompile(`/\.qpkg/([^/]+)/`)
+
+// ProcessGroup aggregates the resource usage of the processes whose name matches Pattern
+type ProcessGroup struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// ParseProcessGroups parses a list of process groups in the <name>=<regexp>[;<name>=<regexp>...] format,
+// e.g. "plex=^Plex;containers=^(dockerd|containerd)"
+func ParseProcessGroups(spec string) ([]ProcessGroup, error) {
+	var groups []ProcessGroup
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, pattern, ok := strings.Cut(entry, "=")
+		if !ok || name == "" || pattern == "" {
+			return nil, fmt.Errorf("parse process group %q: expected <name>=<regexp>", entry)
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("parse process group %q: %w", name, err)
+		}
+		groups = append(groups, ProcessGroup{Name: name, Pattern: re})
+	}
+
+	return groups, nil
+}
+
+// processKey identifies a process across scrapes, as PIDs are reused
+type processKey struct {
+	pid        int32
+	createTime int64
+}
+
+// processSample is the resource usage of a single process
+type processSample struct {
+	key          processKey
+	name         string
+	exe          string
+	cpuSeconds   float64
+	rssBytes     float64
+	readBytes    float64
+	writtenBytes float64
+	threads      float64
+	fds          float64
+}
+
+// processGroupUsage is the resource usage summed over the processes of a group
+type processGroupUsage struct {
+	processes int
+	processSample
+}
+
+func (u *processGroupUsage) add(s processSample) {
+	u.processes++
+	u.cpuSeconds += s.cpuSeconds
+	u.rssBytes += s.rssBytes
+	u.readBytes += s.readBytes
+	u.writtenBytes += s.writtenBytes
+	u.threads += s.threads
+	u.fds += s.fds
+}
+
+// qpkgFromExe returns the QPKG that installed the executable, if any
+func qpkgFromExe(exe string) string {
+	if matches := qpkgExeRe.FindStringSubmatch(exe); matches != nil {
+		return matches[1]
+	}
+
+	return ""
+}
+
+// processGroupOf returns the first configured group that matches the name of the process, if any
+func processGroupOf(s processSample, groups []ProcessGroup) string {
+	for _, g := range groups {
+		if g.Pattern.MatchString(s.name) {
+			return g.Name
+		}
+	}
+
+	return ""
+}
+
+// groupProcesses sums the usage of the processes per configured group, where each process counts towards
+// the first group that matches its name, and per QPKG
+func groupProcesses(samples []processSample, groups []ProcessGroup) (byGroup, byQpkg map[string]*processGroupUsage) {
+	byGroup = make(map[string]*processGroupUsage, len(groups))
+	for _, g := range groups {
+		byGroup[g.Name] = &processGroupUsage{}
+	}
+	byQpkg = make(map[string]*processGroupUsage)
+
+	for _, s := range samples {
+		if group := processGroupOf(s, groups); group != "" {
+			byGroup[group].add(s)
+		}
+
+		if qpkg := qpkgFromExe(s.exe); qpkg != "" {
+			if byQpkg[qpkg] == nil {
+				byQpkg[qpkg] = &processGroupUsage{}
+			}
+			byQpkg[qpkg].add(s)
+		}
+	}
+
+	return byGroup, byQpkg
+}
+
+// processCounters accumulates the counters of the processes that exited, so that the counters of their
+// group do not decrease when they exit, as process-exporter does
+type processCounters struct {
+	mu sync.Mutex
+	// last holds the processes seen by the previous scrape
+	last map[processKey]processSample
+	// exitedGroups and exitedQpkgs hold the CPU time and I/O of the exited processes of each group
+	exitedGroups map[string]processSample
+	exitedQpkgs  map[string]processSample
+}
+
+func newProcessCounters() *processCounters {
+	return &processCounters{
+		exitedGroups: make(map[string]processSample),
+		exitedQpkgs:  make(map[string]processSample),
+	}
+}
+
+// update records the processes that exited since the previous scrape, and adds the counters of all
+// the exited processes to the group usages
+func (c *processCounters) update(samples []processSample, groups []ProcessGroup, byGroup, byQpkg map[string]*processGroupUsage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current := make(map[processKey]processSample, len(samples))
+	for _, s := range samples {
+		current[s.key] = s
+	}
+	for key, s := range c.last {
+		if _, ok := current[key]; ok {
+			continue
+		}
+
+		if group := processGroupOf(s, groups); group != "" {
+			c.exitedGroups[group] = addProcessCounters(c.exitedGroups[group], s)
+		}
+		if qpkg := qpkgFromExe(s.exe); qpkg != "" {
+			c.exitedQpkgs[qpkg] = addProcessCounters(c.exitedQpkgs[qpkg], s)
+		}
+	}
+	c.last = current
+
+	for group, exited := range c.exitedGroups {
+		if u, ok := byGroup[group]; ok {
+			u.processSample = addProcessCounters(u.processSample, exited)
+		}
+	}
+	for qpkg, exited := range c.exitedQpkgs {
+		// Keep reporting the QPKGs whose processes all exited, e.g. after being stopped
+		if byQpkg[qpkg] == nil {
+			byQpkg[qpkg] = &processGroupUsage{}
+		}
+		byQpkg[qpkg].processSample = addProcessCounters(byQpkg[qpkg].processSample, exited)
+	}
+}
+
+// addProcessCounters adds the CPU time and I/O counters of s to total
+func addProcessCounters(total, s processSample) processSample {
+	total.cpuSeconds += s.cpuSeconds
+	total.readBytes += s.readBytes
+	total.writtenBytes += s.writtenBytes
+
+	return total
+}
+
+func readProcessSamples() ([]processSample, error) {
+	procs, err := process.Processes()
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]processSample, 0, len(procs))
+	for _, p := range procs {
+		// Processes can exit while being read, and some attributes require privileges, so errors are ignored
+		name, err := p.Name()
+		if err != nil {
+			continue
+		}
+
+		s := processSample{key: processKey{pid: p.Pid}, name: name}
+		s.key.createTime, _ = p.CreateTime()
+		s.exe, _ = p.Exe()
+		if t, err := p.Times(); err == nil {
+			s.cpuSeconds = t.User + t.System
+		}
+		if m, err := p.MemoryInfo(); err == nil {
+			s.rssBytes = float64(m.RSS)
+		}
+		if counters, err := p.IOCounters(); err == nil {
+			s.readBytes = float64(counters.ReadBytes)
+			s.writtenBytes = float64(counters.WriteBytes)
+		}
+		if n, err := p.NumThreads(); err == nil {
+			s.threads = float64(n)
+		}
+		if n, err := p.NumFDs(); err == nil {
+			s.fds = float64(n)
+		}
+		samples = append(samples, s)
+	}
+
+	return samples, nil
+}
+
+func (e *promExporter) getProcessMetrics() ([]metric, error) {
+	if !e.ProcessMetrics {
+		return nil, nil
+	}
+
+	samples, err := readProcessSamples()
+	if err != nil {
+		return nil, fmt.Errorf("list processes: %w", err)
+	}
+
+	byGroup, byQpkg := groupProcesses(samples, e.ProcessGroups)
+	e.processCounters.update(samples, e.ProcessGroups, byGroup, byQpkg)
+	metrics := make([]metric, 0, (len(byGroup)+len(byQpkg))*7)
+	metrics = appendProcessGroupMetrics(metrics, "node_process_group", "node_process_group_processes", "group", byGroup)
+	metrics = appendProcessGroupMetrics(metrics, "node_qpkg_process", "node_qpkg_processes", "qpkg", byQpkg)
+
+	return metrics, nil
+}
+
+func appendProcessGroupMetrics(metrics []metric, prefix, processesName, label string, usages map[string]*processGroupUsage) []metric {
+	names := make([]string, 0, len(usages))
+	for name := range usages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		u := usages[name]
+		attr := fmt.Sprintf("%s=%q", label, name)
+		metrics = append(
+			metrics,
+			metric{
+				name:       processesName,
+				attr:       attr,
+				value:      float64(u.processes),
+				help:       "Number of running processes",
+				metricType: "gauge",
+			},
+			metric{
+				name:       prefix + "_cpu_seconds_total",
+				attr:       attr,
+				value:      u.cpuSeconds,
+				help:       "CPU time spent by the processes in user and system mode, including the processes that exited",
+				metricType: "counter",
+			},
+			metric{
+				name:       prefix + "_resident_memory_bytes",
+				attr:       attr,
+				value:      u.rssBytes,
+				help:       "Resident memory size of the running processes",
+				metricType: "gauge",
+			},
+			metric{
+				name:       prefix + "_read_bytes_total",
+				attr:       attr,
+				value:      u.readBytes,
+				help:       "Number of bytes read from storage by the processes, including the processes that exited",
+				metricType: "counter",
+			},
+			metric{
+				name:       prefix + "_written_bytes_total",
+				attr:       attr,
+				value:      u.writtenBytes,
+				help:       "Number of bytes written to storage by the processes, including the processes that exited",
+				metricType: "counter",
+			},
+			metric{
+				name:       prefix + "_threads",
+				attr:       attr,
+				value:      u.threads,
+				help:       "Number of threads of the running processes",
+				metricType: "gauge",
+			},
+			metric{
+				name:       prefix + "_open_fds",
+				attr:       attr,
+				value:      u.fds,
+				help:       "Number of file descriptors opened by the running processes",
+				metricType: "gauge",
+			},
+		)
+	}
+
+	return metrics
+}
@@ -0,0 +1,104 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProcessGroups(t *testing.T) {
+	groups, err := ParseProcessGroups("plex=^Plex; containers=^(dockerd|containerd);")
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.Equal(t, "plex", groups[0].Name)
+	assert.True(t, groups[0].Pattern.MatchString("Plex Media Server"))
+	assert.Equal(t, "containers", groups[1].Name)
+	assert.True(t, groups[1].Pattern.MatchString("containerd-shim"))
+
+	groups, err = ParseProcessGroups("")
+	require.NoError(t, err)
+	assert.Empty(t, groups)
+
+	_, err = ParseProcessGroups("plex")
+	assert.Error(t, err)
+	_, err = ParseProcessGroups("plex=(")
+	assert.Error(t, err)
+}
+
+func TestQpkgFromExe(t *testing.T) {
+	assert.Equal(t, "PlexMediaServer", qpkgFromExe("/share/CACHEDEV1_DATA/.qpkg/PlexMediaServer/Plex Media Server"))
+	assert.Equal(t, "container-station", qpkgFromExe("/share/ZFS530_DATA/.qpkg/container-station/bin/dockerd"))
+	assert.Empty(t, qpkgFromExe("/usr/local/sbin/qsirch"))
+	assert.Empty(t, qpkgFromExe(""))
+}
+
+func TestGroupProcesses(t *testing.T) {
+	groups, err := ParseProcessGroups("plex=^Plex;all=.")
+	require.NoError(t, err)
+
+	byGroup, byQpkg := groupProcesses([]processSample{
+		{name: "Plex Media Server", exe: "/share/CACHEDEV1_DATA/.qpkg/PlexMediaServer/Plex Media Server", cpuSeconds: 10, rssBytes: 100, threads: 20, fds: 50},
+		{name: "Plex Transcoder", exe: "/share/CACHEDEV1_DATA/.qpkg/PlexMediaServer/Plex Transcoder", cpuSeconds: 5, rssBytes: 50, readBytes: 1000, threads: 4, fds: 10},
+		{name: "smbd", exe: "/usr/local/samba/sbin/smbd", cpuSeconds: 1, rssBytes: 10, writtenBytes: 200, threads: 1, fds: 5},
+	}, groups)
+
+	assert.Equal(t, map[string]*processGroupUsage{
+		"plex": {processes: 2, processSample: processSample{cpuSeconds: 15, rssBytes: 150, readBytes: 1000, threads: 24, fds: 60}},
+		"all":  {processes: 1, processSample: processSample{cpuSeconds: 1, rssBytes: 10, writtenBytes: 200, threads: 1, fds: 5}},
+	}, byGroup)
+	assert.Equal(t, map[string]*processGroupUsage{
+		"PlexMediaServer": {processes: 2, processSample: processSample{cpuSeconds: 15, rssBytes: 150, readBytes: 1000, threads: 24, fds: 60}},
+	}, byQpkg)
+}
+
+func TestAppendProcessGroupMetrics(t *testing.T) {
+	metrics := appendProcessGroupMetrics(nil, "node_qpkg_process", "node_qpkg_processes", "qpkg", map[string]*processGroupUsage{
+		"b": {processes: 1},
+		"a": {processes: 2, processSample: processSample{cpuSeconds: 3}},
+	})
+
+	require.Len(t, metrics, 14)
+	assert.Equal(t, metric{name: "node_qpkg_processes", attr: `qpkg="a"`, value: 2, help: "Number of running processes", metricType: "gauge"}, metrics[0])
+	assert.Equal(t, "node_qpkg_process_cpu_seconds_total", metrics[1].name)
+	assert.Equal(t, 3.0, metrics[1].value)
+	assert.Equal(t, `qpkg="b"`, metrics[7].attr)
+}
+
+func TestProcessCountersKeepExitedProcesses(t *testing.T) {
+	groups, err := ParseProcessGroups("plex=^Plex")
+	require.NoError(t, err)
+	server := processSample{key: processKey{pid: 10, createTime: 1}, name: "Plex Media Server", exe: "/share/CACHEDEV1_DATA/.qpkg/PlexMediaServer/Plex Media Server", cpuSeconds: 10, readBytes: 100}
+	transcoder := processSample{key: processKey{pid: 20, createTime: 2}, name: "Plex Transcoder", exe: "/share/CACHEDEV1_DATA/.qpkg/PlexMediaServer/Plex Transcoder", cpuSeconds: 50, writtenBytes: 500, rssBytes: 300}
+	c := newProcessCounters()
+
+	samples := []processSample{server, transcoder}
+	byGroup, byQpkg := groupProcesses(samples, groups)
+	c.update(samples, groups, byGroup, byQpkg)
+	assert.Equal(t, 60.0, byGroup["plex"].cpuSeconds)
+
+	// The transcoder exits, and its PID is reused by an unrelated process
+	server.cpuSeconds = 12
+	samples = []processSample{server, {key: processKey{pid: 20, createTime: 3}, name: "smbd", cpuSeconds: 1}}
+	byGroup, byQpkg = groupProcesses(samples, groups)
+	c.update(samples, groups, byGroup, byQpkg)
+
+	assert.Equal(t, &processGroupUsage{processes: 1, processSample: processSample{cpuSeconds: 62, readBytes: 100, writtenBytes: 500}}, byGroup["plex"])
+	assert.Equal(t, byGroup["plex"], byQpkg["PlexMediaServer"])
+
+	// The QPKG keeps being reported after all its processes exit
+	samples = nil
+	byGroup, byQpkg = groupProcesses(samples, groups)
+	c.update(samples, groups, byGroup, byQpkg)
+
+	assert.Equal(t, &processGroupUsage{processSample: processSample{cpuSeconds: 62, readBytes: 100, writtenBytes: 500}}, byGroup["plex"])
+	assert.Equal(t, byGroup["plex"], byQpkg["PlexMediaServer"])
+}
+
+func TestGetProcessMetricsDisabled(t *testing.T) {
+	e := &promExporter{processCounters: newProcessCounters()}
+
+	metrics, err := e.getProcessMetrics()
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+}
@@ -8,11 +8,14 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/moby/moby/client"
 	"github.com/pedropombeiro/qnapexporter/lib/exporter"
 	"github.com/pedropombeiro/qnapexporter/lib/utils"
 )
@@ -23,8 +26,9 @@ const (
 	flashcacheStatsPath        = "/proc/flashcache/CG0/flashcache_stats"
 	dmCacheStatsFilePathFormat = "/sys/block/%s/dm/cache/curr_stats"
 
-	envValidity    = time.Duration(5 * time.Minute)
-	volumeValidity = time.Duration(1 * time.Minute)
+	envValidity       = time.Duration(5 * time.Minute)
+	volumeValidity    = time.Duration(1 * time.Minute)
+	fanStatusValidity = time.Duration(1 * time.Minute)
 )
 
 type fetchMetricFn func() ([]metric, error)
@@ -34,7 +38,11 @@ type qnapEnclosure struct {
 	name      string
 	diskCount int
 	fanCount  int
+	psuCount  int
 	tempCount int
+	connected bool
+	// disks maps the occupied slots of the enclosure to the kernel device names
+	disks map[int]string
 }
 
 type promExporter struct {
@@ -44,25 +52,49 @@ type promExporter struct {
 
 	hostname      string
 	kernelVersion int
+	genericLinux  bool
 
 	upsState upsState
 
-	getsysinfo  string
-	syshdnum    int
-	sysfannum   int
-	ifaces      []string
-	devices     []string
-	nvmePath    string
-	nvmeDevices []string
-	halApp      string
-	enclosures  []qnapEnclosure
-	envExpiry   time.Time
+	getsysinfo      string
+	syshdnum        int
+	sysfannum       int
+	ifaces          []string
+	devices         []string
+	nvmePath        string
+	nvmeDevices     []string
+	nvmeControllers map[string]nvmeControllerInfo
+	halApp          string
+	hdparm          string
+	lvs             string
+	zpool           string
+	zfs             string
+	smbstatus       string
+	repquota        string
+	virsh           string
+	docker          *client.Client
+	diskSlots       map[int]string
+	disks           []diskInfo
+	chassis         qnapEnclosure
+	enclosures      []qnapEnclosure
+	envExpiry       time.Time
+
+	diskPowerStates map[string]string
+	hdLastMetrics   map[int]metric
+	hwmonChips      []hwmonChip
+
+	rootFanStates       []string
+	rootFanStatesExpiry time.Time
 
 	volumes         []volumeInfo
 	volumeLastFetch time.Time
 
-	dmCacheClients           []string
-	dmCacheDeviceMinorNumber string
+	processCounters *processCounters
+
+	dmCacheClients      []string
+	dmCacheStatsDevices []string
+	dmCacheTargets      []string
+	bcacheDevices       []string
 
 	fns     map[string]fetchMetricFn
 	fetchMu sync.Mutex
@@ -70,8 +102,21 @@ type promExporter struct {
 
 // ExporterConfig holds the configuration options for the Prometheus exporter.
 type ExporterConfig struct {
-	PingTarget string
-	Logger     *log.Logger
+	PingTarget       string
+	MetricsSchema    MetricsSchema
+	MetricsNamespace MetricsNamespace
+	// SkipHostMetrics disables the collectors of generic host metrics already provided by node_exporter
+	SkipHostMetrics bool
+	// MaxQuotaUsers caps the number of users reported per device by the quota collector (0 for no limit)
+	MaxQuotaUsers int
+	// ProcessMetrics enables the process collector, which aggregates the resource usage of the processes
+	// by QPKG and by ProcessGroups
+	ProcessMetrics bool
+	// ProcessGroups lists the process name patterns whose resource usage is aggregated by the process collector
+	ProcessGroups []ProcessGroup
+	// DockerEvents counts the events received by the Docker event handler
+	DockerEvents *DockerEventCounter
+	Logger       *log.Logger
 }
 
 // NewExporter creates a Prometheus exporter using the given configuration and
@@ -79,9 +124,11 @@ type ExporterConfig struct {
 func NewExporter(config ExporterConfig, status *exporter.Status) exporter.Exporter {
 	now := time.Now()
 	e := &promExporter{
-		ExporterConfig: config,
-		status:         status,
-		envExpiry:      now,
+		ExporterConfig:  config,
+		status:          status,
+		envExpiry:       now,
+		hdLastMetrics:   make(map[int]metric),
+		processCounters: newProcessCounters(),
 	}
 	e.fns = map[string]fetchMetricFn{
 		"version":         e.getVersionMetrics,
@@ -93,16 +140,40 @@ func NewExporter(config ExporterConfig, status *exporter.Status) exporter.Export
 		"SysInfoTemp":     e.getSysInfoTempMetrics,
 		"SysInfoFan":      e.getSysInfoFanMetrics,
 		"EnclosureFan":    e.getEnclosureFanMetrics,
+		"Enclosure":       e.getEnclosureMetrics,
+		"Chassis":         e.getChassisMetrics,
+		"HwmonSensors":    e.getHwmonSensorMetrics,
+		"HwmonSysInfo":    e.getHwmonSysInfoMetrics,
 		"SysInfoHd":       e.getSysInfoHdMetrics,
+		"DiskPowerState":  e.getDiskPowerStateMetrics,
+		"DiskInfo":        e.getDiskInfoMetrics,
 		"SysInfoVol":      e.getSysInfoVolMetrics,
 		"DiskStats":       e.getDiskStatsMetrics,
 		"FlashCacheStats": e.getFlashCacheStatsMetrics,
 		"DmCacheStats":    e.getDmCacheStatsMetrics,
+		"Bcache":          e.getBcacheMetrics,
+		"MdStat":          getMdStatMetrics,
+		"Lvm":             e.getLvmMetrics,
+		"Zfs":             e.getZfsMetrics,
+		"Iscsi":           getIscsiMetrics,
+		"Smb":             e.getSmbMetrics,
+		"Nfs":             getNfsMetrics,
+		"Quota":           e.getQuotaMetrics,
+		"Processes":       e.getProcessMetrics,
+		"Docker":          e.getDockerMetrics,
+		"DockerEvents":    e.getDockerEventMetrics,
+		"Libvirt":         e.getLibvirtMetrics,
 		"NetworkStats":    e.getNetworkStatsMetrics,
 		"Ping":            e.getPingMetrics,
 		"NvmeSmart":       e.getNvmeSmartMetrics,
 	}
 
+	if config.SkipHostMetrics {
+		for _, name := range hostCollectors {
+			delete(e.fns, name)
+		}
+	}
+
 	if status != nil {
 		status.Uptime = now
 	}
@@ -125,6 +196,11 @@ func (e *promExporter) WriteMetrics(w io.Writer) error {
 	if time.Now().After(e.envExpiry) {
 		e.readEnvironment()
 	}
+	e.readDiskPowerStates()
+	if e.getsysinfo == "" {
+		// Read once for the hwmon collectors, after the disk power states so that sleeping disks are skipped
+		e.hwmonChips = e.readAwakeHwmonChips(hwmonDir)
+	}
 
 	var wg sync.WaitGroup
 	metricsCh := make(chan interface{}, 4)
@@ -142,20 +218,34 @@ func (e *promExporter) WriteMetrics(w io.Writer) error {
 
 	// Retrieve metrics from channel and write them to the response
 	var err error
+	written := make(map[string]bool)
 	for m := range metricsCh {
 		switch v := m.(type) {
 		case []metric:
-			if e.status != nil {
-				e.status.MetricCount += len(v)
-			}
 			for _, m := range v {
+				m, ok := applyMetricsSchema(e.MetricsSchema, m)
+				if !ok {
+					continue
+				}
+				m = applyMetricsNamespace(e.MetricsNamespace, m)
+
+				fullName := e.getMetricFullName(m)
+				if written[fullName] {
+					// Several v1 metrics can map to the same v2 metric
+					continue
+				}
+				written[fullName] = true
+
+				if e.status != nil {
+					e.status.MetricCount++
+				}
 				writeMetricMetadata(w, m)
 
 				var timestamp string
 				if !m.timestamp.IsZero() {
 					timestamp = strconv.Itoa(int(m.timestamp.UnixNano() / 1000000))
 				}
-				_, _ = fmt.Fprintf(w, "%s %g %s\n", e.getMetricFullName(m), m.value, timestamp)
+				_, _ = fmt.Fprintf(w, "%s %g %s\n", fullName, m.value, timestamp)
 			}
 		case error:
 			err = v
@@ -186,6 +276,9 @@ func (e *promExporter) Close() {
 		_, _ = e.upsState.upsClient.Disconnect()
 		e.upsState.upsLock.Unlock()
 	}
+	if e.docker != nil {
+		_ = e.docker.Close()
+	}
 }
 
 func (e *promExporter) readEnvironment() {
@@ -194,10 +287,21 @@ func (e *promExporter) readEnvironment() {
 	e.readHostInfo()
 	e.readSysInfo()
 	e.readEnclosures()
+	e.readPlatform()
 	e.readNetworkInterfaces()
 	e.readDevices()
+	e.readDiskInventory()
+	e.readHdparmPath()
 	e.readNvmePath()
+	e.readNvmeControllers()
 	e.readDmCacheDevices()
+	e.readBcacheDevices()
+	e.readLvsPath()
+	e.readZfsPaths()
+	e.readSmbstatusPath()
+	e.readRepquotaPath()
+	e.readDockerClient()
+	e.readVirshPath()
 
 	e.envExpiry = e.envExpiry.Add(envValidity)
 
@@ -265,30 +369,53 @@ func (e *promExporter) readEnclosures() {
 		}
 		e.Logger.Printf("Retrieved hal_app path: %q", e.halApp)
 	}
+	previous := e.enclosures
 	e.enclosures = nil
 	e.status.Enclosures = nil
 	if e.halApp == "" {
 		return
 	}
 
-	e.Logger.Println("Retrieving QM2 enclosures")
+	e.Logger.Println("Retrieving enclosures")
 	seEnumOutput, err := utils.ExecCommand(e.halApp, "--se_enum")
 	if err != nil {
 		return
 	}
 
-	for _, line := range utils.FindMatchingLines("qm2_", seEnumOutput) {
-		fields := strings.Fields(line)
-		enc := qnapEnclosure{
-			id:   fields[2],
-			name: fields[4],
+	for _, enc := range parseSeEnum(seEnumOutput) {
+		if enc.id == "root" {
+			// The NAS itself, whose disks and fans are reported through getsysinfo
+			e.chassis = enc
+			continue
 		}
-		enc.diskCount, _ = strconv.Atoi(fields[7])
-		enc.fanCount, _ = strconv.Atoi(fields[8])
-		enc.tempCount, _ = strconv.Atoi(fields[10])
-		if enc.fanCount != 0 {
+
+		e.enclosures = append(e.enclosures, enc)
+		e.status.Enclosures = append(e.status.Enclosures, enc.name)
+	}
+
+	// Keep reporting expansion units that were disconnected since the last discovery
+	for _, enc := range previous {
+		if !slices.ContainsFunc(e.enclosures, func(c qnapEnclosure) bool { return c.id == enc.id }) {
+			enc.connected = false
+			enc.disks = nil
 			e.enclosures = append(e.enclosures, enc)
-			e.status.Enclosures = append(e.status.Enclosures, enc.name)
+		}
+	}
+	e.Logger.Printf("Found enclosures: %v", e.status.Enclosures)
+}
+
+// readPlatform detects whether the exporter runs on QTS, or on a generic Linux host where the
+// QNAP tools are not available and the metrics are collected from Linux-native data sources
+func (e *promExporter) readPlatform() {
+	e.genericLinux = e.getsysinfo == "" && e.halApp == ""
+	if e.genericLinux {
+		e.Logger.Println("QTS not detected, using Linux data sources")
+	}
+
+	if e.status != nil {
+		e.status.Platform = "QTS"
+		if e.genericLinux {
+			e.status.Platform = "Linux"
 		}
 	}
 }
@@ -347,6 +474,8 @@ func (e *promExporter) readNvmePath() {
 
 func (e *promExporter) readDmCacheDevices() {
 	e.dmCacheClients = []string{}
+	e.dmCacheStatsDevices = []string{}
+	e.dmCacheTargets = []string{}
 	if e.kernelVersion < 5 {
 		return
 	}
@@ -362,15 +491,20 @@ func (e *promExporter) readDmCacheDevices() {
 	}
 	e.Logger.Printf("Found cache clients: %v", e.dmCacheClients)
 
-	table, err = utils.ExecCommand("dmsetup", "ls")
+	// Caches set up with LVM or dmsetup on generic Linux hosts
+	targets, err := utils.ExecCommandGetLines("dmsetup", "table", "--target", "cache")
 	if err == nil {
-		cacheDevices := utils.FindMatchingLines("vg256-lv256\t", table)
-		e.Logger.Printf("Found cache volumes: %v", cacheDevices)
-		if len(cacheDevices) == 1 {
-			e.dmCacheDeviceMinorNumber = strings.Split(cacheDevices[0], ":")[1]
-			e.dmCacheDeviceMinorNumber = strings.TrimRight(e.dmCacheDeviceMinorNumber, ")")
-		}
+		e.dmCacheTargets = parseDmTableNames(targets)
 	}
+	e.Logger.Printf("Found cache targets: %v", e.dmCacheTargets)
+
+	// Each SSD cache group exposes its hit statistics under its own dm device
+	statsFiles, _ := filepath.Glob(fmt.Sprintf(dmCacheStatsFilePathFormat, "dm-*"))
+	for _, f := range statsFiles {
+		dev := strings.SplitN(strings.TrimPrefix(f, blockDir+"/"), "/", 2)[0]
+		e.dmCacheStatsDevices = append(e.dmCacheStatsDevices, dev)
+	}
+	e.Logger.Printf("Found cache volumes: %v", e.dmCacheStatsDevices)
 }
 
 func (e *promExporter) updateStatusEnvironment() {
@@ -382,11 +516,7 @@ func (e *promExporter) updateStatusEnvironment() {
 	e.status.NvmeDevices = e.nvmeDevices
 	e.status.Interfaces = e.ifaces
 	e.status.DmCaches = e.dmCacheClients
-	if e.dmCacheDeviceMinorNumber != "" {
-		e.status.DmCacheDevice = fmt.Sprintf("dm-%s", e.dmCacheDeviceMinorNumber)
-	} else {
-		e.status.DmCacheDevice = ""
-	}
+	e.status.DmCacheDevices = append(slices.Clone(e.dmCacheStatsDevices), e.bcacheDevices...)
 }
 
 func (e *promExporter) getMetricFullName(m metric) string {
@@ -46,6 +46,26 @@ func TestWriteMetrics(t *testing.T) {
 	assert.NotZero(t, s.MetricCount)
 }
 
+func TestWriteMetricsQnapNamespace(t *testing.T) {
+	var s exporter.Status
+	config := ExporterConfig{
+		PingTarget:       "8.8.8.8",
+		MetricsNamespace: MetricsNamespaceQnap,
+		SkipHostMetrics:  true,
+		Logger:           log.New(io.Discard, "", 0),
+	}
+	e := NewExporter(config, &s)
+	b := new(bytes.Buffer)
+	defer e.Close()
+
+	_ = e.WriteMetrics(b)
+
+	output := b.String()
+	assert.NotContains(t, output, "\nnode_")
+	assert.NotContains(t, output, "qnap_load1")
+	assert.NotContains(t, output, "qnap_time_seconds")
+}
+
 func BenchmarkWriteMetrics(b *testing.B) {
 	config := ExporterConfig{
 		PingTarget: "8.8.8.8",
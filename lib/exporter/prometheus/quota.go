@@ -0,0 +1,245 @@
+package prometheus
+
+import (
+	"cmp"
+	"fmt"
+	"os/exec"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/pedropombeiro/qnapexporter/lib/utils"
+)
+
+const projectsPath = "/etc/projects"
+
+// smbConfPaths lists where the shared folder definitions are found, on QTS and on generic Linux hosts
+var smbConfPaths = []string{"/etc/config/smb.conf", "/etc/samba/smb.conf"}
+
+// quotaUsage is the disk usage and limits of a user or project (shared folder) on a device
+type quotaUsage struct {
+	device         string
+	name           string
+	usedBytes      float64
+	softLimitBytes float64
+	hardLimitBytes float64
+}
+
+func (e *promExporter) readRepquotaPath() {
+	if e.repquota != "" {
+		return
+	}
+
+	e.repquota, _ = exec.LookPath("repquota")
+	if e.repquota != "" {
+		e.Logger.Printf("Retrieved repquota path: %q", e.repquota)
+	}
+}
+
+// parseRepquota parses the output of `repquota -a`, whose block counts are in 1 KiB units:
+//
+//	*** Report for user quotas on device /dev/mapper/cachedev1
+//	Block grace time: 7days; Inode grace time: 7days
+//	                        Block limits                File limits
+//	User            used    soft    hard  grace    used  soft  hard  grace
+//	----------------------------------------------------------------------
+//	alice     +-  2048000 2000000 2100000  6days     100     0     0
+func parseRepquota(output string) []quotaUsage {
+	var usages []quotaUsage
+	device := ""
+	inTable := false
+	for _, line := range strings.Split(output, "\n") {
+		if after, ok := strings.CutPrefix(line, "*** Report for "); ok {
+			_, device, _ = strings.Cut(after, " on device ")
+			device = strings.TrimSpace(device)
+			inTable = false
+			continue
+		}
+		if strings.HasPrefix(line, "---") {
+			inTable = true
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if !inTable || len(fields) < 5 {
+			continue
+		}
+
+		number := func(idx int) float64 {
+			v, _ := strconv.ParseFloat(fields[idx], 64)
+			return v * 1024
+		}
+		usages = append(usages, quotaUsage{
+			device:         device,
+			name:           fields[0],
+			usedBytes:      number(2),
+			softLimitBytes: number(3),
+			hardLimitBytes: number(4),
+		})
+	}
+
+	return usages
+}
+
+// parseSmbConfShares maps the path of each shared folder defined in smb.conf to its name
+func parseSmbConfShares(content string) map[string]string {
+	shares := make(map[string]string)
+	section := ""
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.Trim(line, "[]")
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || section == "" || section == "global" || strings.TrimSpace(key) != "path" {
+			continue
+		}
+		shares[path.Clean(strings.TrimSpace(value))] = section
+	}
+
+	return shares
+}
+
+// readProjectShares maps the project quota IDs to the names of the shared folders they cover,
+// using the <id>:<path> entries of the projects file
+func readProjectShares(projectsPath string, smbConfPaths []string) map[string]string {
+	lines, err := utils.ReadFileLines(projectsPath)
+	if err != nil {
+		return nil
+	}
+
+	shares := make(map[string]string)
+	for _, p := range smbConfPaths {
+		if content, err := utils.ReadFile(p); err == nil {
+			for sharePath, name := range parseSmbConfShares(content) {
+				shares[sharePath] = name
+			}
+		}
+	}
+
+	projects := make(map[string]string, len(lines))
+	for _, line := range lines {
+		id, projectPath, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok || strings.HasPrefix(id, "#") {
+			continue
+		}
+
+		projectPath = path.Clean(projectPath)
+		name, ok := shares[projectPath]
+		if !ok {
+			name = path.Base(projectPath)
+		}
+		projects["#"+id] = name
+	}
+
+	return projects
+}
+
+// capQuotaUsages keeps the maxUsers largest consumers of each device, and returns the number of users left out per device.
+// A maxUsers of 0 disables the cap.
+func capQuotaUsages(usages []quotaUsage, maxUsers int) ([]quotaUsage, map[string]int) {
+	omitted := make(map[string]int)
+	if maxUsers <= 0 {
+		return usages, omitted
+	}
+
+	sorted := slices.Clone(usages)
+	slices.SortStableFunc(sorted, func(a, b quotaUsage) int {
+		return cmp.Or(cmp.Compare(a.device, b.device), cmp.Compare(b.usedBytes, a.usedBytes))
+	})
+
+	kept := make([]quotaUsage, 0, len(sorted))
+	perDevice := make(map[string]int)
+	for _, u := range sorted {
+		if perDevice[u.device] >= maxUsers {
+			omitted[u.device]++
+			continue
+		}
+		perDevice[u.device]++
+		kept = append(kept, u)
+	}
+
+	return kept, omitted
+}
+
+func (e *promExporter) getQuotaMetrics() ([]metric, error) {
+	if e.repquota == "" {
+		return nil, nil
+	}
+
+	output, err := utils.ExecCommand(e.repquota, "-a", "-u")
+	if err != nil {
+		return nil, fmt.Errorf("get user quotas: %w", err)
+	}
+
+	var users []quotaUsage
+	for _, u := range parseRepquota(output) {
+		// Skip the system accounts that neither use space nor have a quota
+		if u.usedBytes == 0 && u.softLimitBytes == 0 && u.hardLimitBytes == 0 {
+			continue
+		}
+		users = append(users, u)
+	}
+	users, omitted := capQuotaUsages(users, e.MaxQuotaUsers)
+
+	metrics := make([]metric, 0, len(users)*3)
+	for _, u := range users {
+		metrics = appendQuotaMetrics(metrics, "user", fmt.Sprintf("device=%q,user=%q", u.device, u.name), u)
+	}
+	for device, count := range omitted {
+		metrics = append(metrics, metric{
+			name:       "node_user_quota_omitted_users",
+			attr:       fmt.Sprintf("device=%q", device),
+			value:      float64(count),
+			help:       "Number of users left out of the quota metrics by the --max-quota-users limit",
+			metricType: "gauge",
+		})
+	}
+
+	// Shared folder quotas are enforced through project quotas, which are not enabled on every file system
+	output, err = utils.ExecCommand(e.repquota, "-a", "-P", "-n")
+	if err != nil {
+		return metrics, nil
+	}
+
+	projects := readProjectShares(projectsPath, smbConfPaths)
+	for _, p := range parseRepquota(output) {
+		share, ok := projects[p.name]
+		if !ok {
+			share = p.name
+		}
+		metrics = appendQuotaMetrics(metrics, "share", fmt.Sprintf("device=%q,share=%q", p.device, share), p)
+	}
+
+	return metrics, nil
+}
+
+func appendQuotaMetrics(metrics []metric, kind, attr string, u quotaUsage) []metric {
+	return append(
+		metrics,
+		metric{
+			name:       fmt.Sprintf("node_%s_quota_used_bytes", kind),
+			attr:       attr,
+			value:      u.usedBytes,
+			help:       fmt.Sprintf("Disk space used by the %s", kind),
+			metricType: "gauge",
+		},
+		metric{
+			name:       fmt.Sprintf("node_%s_quota_soft_limit_bytes", kind),
+			attr:       attr,
+			value:      u.softLimitBytes,
+			help:       fmt.Sprintf("Soft quota limit of the %s (0 if unlimited)", kind),
+			metricType: "gauge",
+		},
+		metric{
+			name:       fmt.Sprintf("node_%s_quota_hard_limit_bytes", kind),
+			attr:       attr,
+			value:      u.hardLimitBytes,
+			help:       fmt.Sprintf("Hard quota limit of the %s (0 if unlimited)", kind),
+			metricType: "gauge",
+		},
+	)
+}
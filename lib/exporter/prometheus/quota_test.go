@@ -0,0 +1,72 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const repquotaOutput = `*** Report for user quotas on device /dev/mapper/cachedev1
+Block grace time: 7days; Inode grace time: 7days
+                        Block limits                File limits
+User            used    soft    hard  grace    used  soft  hard  grace
+----------------------------------------------------------------------
+admin     --      20       0       0              2     0     0
+alice     +-    2048    2000    2100  6days     100     0     0
+bob       --    1024       0    4096             10     0     0
+
+*** Report for user quotas on device /dev/mapper/cachedev2
+Block grace time: 7days; Inode grace time: 7days
+                        Block limits                File limits
+User            used    soft    hard  grace    used  soft  hard  grace
+----------------------------------------------------------------------
+alice     --     512       0       0              1     0     0
+`
+
+func TestParseRepquota(t *testing.T) {
+	assert.Equal(t, []quotaUsage{
+		{device: "/dev/mapper/cachedev1", name: "admin", usedBytes: 20 * 1024},
+		{device: "/dev/mapper/cachedev1", name: "alice", usedBytes: 2048 * 1024, softLimitBytes: 2000 * 1024, hardLimitBytes: 2100 * 1024},
+		{device: "/dev/mapper/cachedev1", name: "bob", usedBytes: 1024 * 1024, hardLimitBytes: 4096 * 1024},
+		{device: "/dev/mapper/cachedev2", name: "alice", usedBytes: 512 * 1024},
+	}, parseRepquota(repquotaOutput))
+}
+
+func TestCapQuotaUsages(t *testing.T) {
+	usages := parseRepquota(repquotaOutput)
+
+	kept, omitted := capQuotaUsages(usages, 0)
+	assert.Equal(t, usages, kept)
+	assert.Empty(t, omitted)
+
+	kept, omitted = capQuotaUsages(usages, 2)
+	names := make([]string, 0, len(kept))
+	for _, u := range kept {
+		names = append(names, u.device+":"+u.name)
+	}
+	assert.Equal(t, []string{"/dev/mapper/cachedev1:alice", "/dev/mapper/cachedev1:bob", "/dev/mapper/cachedev2:alice"}, names)
+	assert.Equal(t, map[string]int{"/dev/mapper/cachedev1": 1}, omitted)
+}
+
+func TestReadProjectShares(t *testing.T) {
+	root := t.TempDir()
+	writeSysfsFile(t, root, "projects", "# id:path\n10:/share/CACHEDEV1_DATA/Public\n11:/share/CACHEDEV1_DATA/homes/\n12:/share/CACHEDEV2_DATA/Other\n")
+	writeSysfsFile(t, root, "smb.conf", "[global]\npath = /tmp\n\n[Public]\ncomment = System default share\npath = /share/CACHEDEV1_DATA/Public\n\n[homes]\n   path = /share/CACHEDEV1_DATA/homes\n")
+
+	assert.Equal(t, map[string]string{
+		"#10": "Public",
+		"#11": "homes",
+		"#12": "Other",
+	}, readProjectShares(root+"/projects", []string{root + "/smb.conf", root + "/missing.conf"}))
+	assert.Nil(t, readProjectShares(root+"/missing", nil))
+}
+
+func TestAppendQuotaMetrics(t *testing.T) {
+	metrics := appendQuotaMetrics(nil, "share", `device="/dev/md0",share="Public"`, quotaUsage{usedBytes: 10, hardLimitBytes: 20})
+
+	assert.Equal(t, []metric{
+		{name: "node_share_quota_used_bytes", attr: `device="/dev/md0",share="Public"`, value: 10, help: "Disk space used by the share", metricType: "gauge"},
+		{name: "node_share_quota_soft_limit_bytes", attr: `device="/dev/md0",share="Public"`, value: 0, help: "Soft quota limit of the share (0 if unlimited)", metricType: "gauge"},
+		{name: "node_share_quota_hard_limit_bytes", attr: `device="/dev/md0",share="Public"`, value: 20, help: "Hard quota limit of the share (0 if unlimited)", metricType: "gauge"},
+	}, metrics)
+}
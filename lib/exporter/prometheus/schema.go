@@ -0,0 +1,193 @@
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MetricsSchema selects the naming conventions used for the exported metrics
+type MetricsSchema string
+
+const (
+	// MetricsSchemaV1 keeps the historical metric names, units and types
+	MetricsSchemaV1 MetricsSchema = "v1"
+	// MetricsSchemaV2 follows the Prometheus naming conventions for units and types
+	MetricsSchemaV2 MetricsSchema = "v2"
+)
+
+// MetricsSchemas lists the supported metric schemas
+var MetricsSchemas = []MetricsSchema{MetricsSchemaV1, MetricsSchemaV2}
+
+// MetricsNamespace selects the prefix of the metrics that describe the host
+type MetricsNamespace string
+
+const (
+	// MetricsNamespaceNode exports host metrics with the node_ prefix, as node_exporter does
+	MetricsNamespaceNode MetricsNamespace = "node"
+	// MetricsNamespaceQnap exports host metrics with the qnap_ prefix, so they do not collide with node_exporter
+	MetricsNamespaceQnap MetricsNamespace = "qnap"
+)
+
+// MetricsNamespaces lists the supported metric namespaces
+var MetricsNamespaces = []MetricsNamespace{MetricsNamespaceNode, MetricsNamespaceQnap}
+
+// hostCollectors lists the collectors of generic host metrics that node_exporter also provides
+var hostCollectors = []string{
+	"uptime",
+	"loadAvg",
+	"CpuRatio",
+	"MemInfo",
+	"DiskStats",
+	"NetworkStats",
+	"HwmonSensors",
+}
+
+// metricSchemaMapping describes how a v1 metric is exported under the v2 schema.
+// An empty v2 name means the metric is not exported in v2.
+type metricSchemaMapping struct {
+	v1         string
+	v2         string
+	metricType string
+	scale      float64
+	dropLabels []string
+	note       string
+}
+
+// metricsSchemaV2Mappings lists every metric whose name, unit or type differs between the v1 and v2 schemas.
+// The metrics schema documentation is generated from this table.
+var metricsSchemaV2Mappings = []metricSchemaMapping{
+	{v1: "go_program", v2: "qnapexporter_build_info", metricType: "gauge"},
+	{v1: "node_time_seconds", v2: "node_uptime_seconds", metricType: "gauge"},
+	{v1: "node_cputmp_C", v2: "node_cpu_temperature_celsius", metricType: "gauge"},
+	{v1: "node_systmp_C", v2: "node_system_temperature_celsius", metricType: "gauge"},
+	{v1: "node_hdtmp_C", v2: "node_disk_temperature_celsius", metricType: "gauge"},
+	{v1: "node_sysfan_RPM", v2: "node_fan_speed_rpm", metricType: "gauge"},
+	{v1: "node_disk_read_time_msec", v2: "node_disk_read_time_seconds_total", metricType: "counter", scale: 0.001},
+	{v1: "node_disk_write_time_msec", v2: "node_disk_write_time_seconds_total", metricType: "counter", scale: 0.001},
+	{v1: "node_disk_iotime_msec", v2: "node_disk_io_time_seconds_total", metricType: "counter", scale: 0.001},
+	{v1: "node_network_external_roundtrip_time_ms", v2: "node_network_external_roundtrip_time_seconds", metricType: "gauge", scale: 0.001},
+	{v1: "node_volume_avail_bytes", v2: "node_volume_avail_bytes", metricType: "gauge", dropLabels: []string{"status"}, note: "Without the `status` label, see `node_volume_status`"},
+	{v1: "node_volume_size_bytes", v2: "node_volume_size_bytes", metricType: "gauge", dropLabels: []string{"status"}, note: "Without the `status` label, see `node_volume_status`"},
+	{v1: "node_flashcache_cached_blocks", note: "Duplicate of `node_ssd_cache_used_bytes` in cache blocks"},
+	{v1: "node_flashcache_total_blocks", note: "Duplicate of `node_ssd_cache_size_bytes` in cache blocks"},
+	{v1: "node_dmcache_used_bytes_total", v2: "node_ssd_cache_used_bytes", metricType: "gauge"},
+	{v1: "node_dmcache_bytes_total", v2: "node_ssd_cache_size_bytes", metricType: "gauge"},
+	{v1: "node_flashcache_reads", v2: "node_ssd_cache_reads_total", metricType: "counter"},
+	{v1: "node_dmcache_read_total", v2: "node_ssd_cache_reads_total", metricType: "counter"},
+	{v1: "node_flashcache_read_hits", v2: "node_ssd_cache_read_hits_total", metricType: "counter"},
+	{v1: "node_dmcache_read_hit_total", v2: "node_ssd_cache_read_hits_total", metricType: "counter"},
+	{v1: "node_flashcache_read_hit_percent", v2: "node_ssd_cache_read_hit_ratio", metricType: "gauge", scale: 0.01},
+	{v1: "node_dmcache_read_hit_percent", v2: "node_ssd_cache_read_hit_ratio", metricType: "gauge", scale: 0.01},
+	{v1: "node_flashcache_writes", v2: "node_ssd_cache_writes_total", metricType: "counter"},
+	{v1: "node_dmcache_write_total", v2: "node_ssd_cache_writes_total", metricType: "counter"},
+	{v1: "node_flashcache_write_hits", v2: "node_ssd_cache_write_hits_total", metricType: "counter"},
+	{v1: "node_dmcache_write_hit_total", v2: "node_ssd_cache_write_hits_total", metricType: "counter"},
+	{v1: "node_flashcache_write_hit_percent", v2: "node_ssd_cache_write_hit_ratio", metricType: "gauge", scale: 0.01},
+	{v1: "node_dmcache_write_hit_percent", v2: "node_ssd_cache_write_hit_ratio", metricType: "gauge", scale: 0.01},
+	{v1: "node_dmcache_info", v2: "node_ssd_cache_info", metricType: "gauge"},
+	{v1: "node_dmcache_metadata_used_bytes", v2: "node_ssd_cache_metadata_used_bytes", metricType: "gauge"},
+	{v1: "node_dmcache_metadata_size_bytes", v2: "node_ssd_cache_metadata_size_bytes", metricType: "gauge"},
+	{v1: "node_dmcache_dirty_bytes", v2: "node_ssd_cache_dirty_bytes", metricType: "gauge"},
+	{v1: "node_dmcache_demotions_total", v2: "node_ssd_cache_demotions_total", metricType: "counter"},
+	{v1: "node_dmcache_promotions_total", v2: "node_ssd_cache_promotions_total", metricType: "counter"},
+	{v1: "node_dmcache_needs_check", v2: "node_ssd_cache_needs_check", metricType: "gauge"},
+}
+
+var metricsSchemaV2ByName = func() map[string]metricSchemaMapping {
+	m := make(map[string]metricSchemaMapping, len(metricsSchemaV2Mappings))
+	for _, mapping := range metricsSchemaV2Mappings {
+		m[mapping.v1] = mapping
+	}
+	return m
+}()
+
+// applyMetricsSchema converts a metric to the given schema, returning false if the
+// metric is not exported in that schema
+func applyMetricsSchema(schema MetricsSchema, m metric) (metric, bool) {
+	if schema != MetricsSchemaV2 {
+		return m, true
+	}
+
+	mapping, ok := metricsSchemaV2ByName[m.name]
+	if !ok {
+		return m, true
+	}
+	if mapping.v2 == "" {
+		return m, false
+	}
+
+	m.name = mapping.v2
+	m.metricType = mapping.metricType
+	if mapping.scale != 0 {
+		m.value *= mapping.scale
+	}
+	for _, label := range mapping.dropLabels {
+		m.attr = removeMetricLabel(m.attr, label)
+	}
+
+	return m, true
+}
+
+// removeMetricLabel removes the given label from a comma-separated list of label="value" pairs
+func removeMetricLabel(attr, label string) string {
+	var pairs []string
+	for rest := attr; rest != ""; {
+		name, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			return attr
+		}
+		quoted, err := strconv.QuotedPrefix(value)
+		if err != nil {
+			return attr
+		}
+
+		if name != label {
+			pairs = append(pairs, name+"="+quoted)
+		}
+		rest = strings.TrimPrefix(value[len(quoted):], ",")
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+// applyMetricsNamespace renames the node_ metrics to the given namespace
+func applyMetricsNamespace(namespace MetricsNamespace, m metric) metric {
+	if namespace == "" || namespace == MetricsNamespaceNode {
+		return m
+	}
+
+	if name, ok := strings.CutPrefix(m.name, "node_"); ok {
+		m.name = string(namespace) + "_" + name
+	}
+
+	return m
+}
+
+// writeMetricsSchemaMarkdown writes the v1 to v2 metric mapping table as Markdown
+func writeMetricsSchemaMarkdown(w io.Writer) {
+	_, _ = fmt.Fprintln(w, "<!-- Code generated by `mise run docs`. DO NOT EDIT. -->")
+	_, _ = fmt.Fprintln(w, "")
+	_, _ = fmt.Fprintln(w, "# Metrics schema")
+	_, _ = fmt.Fprintln(w, "")
+	_, _ = fmt.Fprintln(w, "qnapexporter exports metrics using the `v1` schema by default, which keeps the historical names used by")
+	_, _ = fmt.Fprintln(w, "existing dashboards. Passing `--metrics-schema=v2` switches to names, units and types that follow the")
+	_, _ = fmt.Fprintln(w, "Prometheus conventions. Metrics not listed below are exported identically in both schemas.")
+	_, _ = fmt.Fprintln(w, "")
+	_, _ = fmt.Fprintln(w, "| v1 metric | v2 metric | v2 type | Conversion |")
+	_, _ = fmt.Fprintln(w, "| --------- | --------- | ------- | ---------- |")
+	for _, m := range metricsSchemaV2Mappings {
+		v2 := "_(removed)_"
+		if m.v2 != "" {
+			v2 = "`" + m.v2 + "`"
+		}
+
+		conversion := m.note
+		if m.scale != 0 {
+			conversion = "× " + strconv.FormatFloat(m.scale, 'g', -1, 64)
+		}
+
+		_, _ = fmt.Fprintf(w, "| `%s` | %s | %s | %s |\n", m.v1, v2, m.metricType, conversion)
+	}
+}
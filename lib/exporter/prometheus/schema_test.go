@@ -0,0 +1,67 @@
+package prometheus
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const metricsSchemaDocPath = "../../../docs/metrics-schema.md"
+
+var updateDocs = flag.Bool("update", false, "update the generated documentation")
+
+func TestApplyMetricsSchema(t *testing.T) {
+	hitPercent := metric{name: "node_dmcache_read_hit_percent", attr: `device="dm-3"`, value: 50, metricType: "counter"}
+
+	m, ok := applyMetricsSchema(MetricsSchemaV1, hitPercent)
+	assert.True(t, ok)
+	assert.Equal(t, hitPercent, m)
+
+	m, ok = applyMetricsSchema(MetricsSchemaV2, hitPercent)
+	assert.True(t, ok)
+	assert.Equal(t, metric{name: "node_ssd_cache_read_hit_ratio", attr: `device="dm-3"`, value: 0.5, metricType: "gauge"}, m)
+
+	_, ok = applyMetricsSchema(MetricsSchemaV2, metric{name: "node_flashcache_cached_blocks"})
+	assert.False(t, ok)
+
+	avail := metric{name: "node_volume_avail_bytes", attr: `volume="Data \"1\"",status="Ready",filesystem="ext4"`, value: 100}
+	m, ok = applyMetricsSchema(MetricsSchemaV1, avail)
+	assert.True(t, ok)
+	assert.Equal(t, avail, m)
+
+	m, ok = applyMetricsSchema(MetricsSchemaV2, avail)
+	assert.True(t, ok)
+	assert.Equal(t, metric{name: "node_volume_avail_bytes", attr: `volume="Data \"1\"",filesystem="ext4"`, value: 100, metricType: "gauge"}, m)
+
+	unmapped := metric{name: "node_load1", value: 1.5}
+	m, ok = applyMetricsSchema(MetricsSchemaV2, unmapped)
+	assert.True(t, ok)
+	assert.Equal(t, unmapped, m)
+}
+
+func TestApplyMetricsNamespace(t *testing.T) {
+	temp := metric{name: "node_hdtmp_C", attr: `hd="1"`, value: 35}
+
+	assert.Equal(t, temp, applyMetricsNamespace(MetricsNamespaceNode, temp))
+	assert.Equal(t, metric{name: "qnap_hdtmp_C", attr: `hd="1"`, value: 35}, applyMetricsNamespace(MetricsNamespaceQnap, temp))
+
+	ups := metric{name: "ups_load", value: 10}
+	assert.Equal(t, ups, applyMetricsNamespace(MetricsNamespaceQnap, ups))
+}
+
+func TestMetricsSchemaDocumentation(t *testing.T) {
+	var b bytes.Buffer
+	writeMetricsSchemaMarkdown(&b)
+
+	if *updateDocs {
+		require.NoError(t, os.WriteFile(metricsSchemaDocPath, b.Bytes(), 0o644))
+	}
+
+	doc, err := os.ReadFile(metricsSchemaDocPath)
+	require.NoError(t, err)
+	assert.Equal(t, b.String(), string(doc), "metrics schema documentation is out of date, run `mise run docs`")
+}
@@ -0,0 +1,192 @@
+package prometheus
+
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"github.com/pedropombeiro/qnapexporter/lib/utils"
+)
+
+// qnapSmbstatusPath is where QTS installs the Samba tools, which is not in the default PATH
+const qnapSmbstatusPath = "/usr/local/samba/bin/smbstatus"
+
+// smbStatus holds the active sessions, share connections and open files reported by `smbstatus`
+type smbStatus struct {
+	sessions    []smbSession
+	connections []smbConnection
+	// openFiles counts the open files in each share path
+	openFiles map[string]int
+}
+
+type smbSession struct {
+	user     string
+	client   string
+	protocol string
+}
+
+type smbConnection struct {
+	share  string
+	client string
+}
+
+func (e *promExporter) readSmbstatusPath() {
+	if e.smbstatus != "" {
+		return
+	}
+
+	for _, p := range []string{"smbstatus", qnapSmbstatusPath} {
+		if path, err := exec.LookPath(p); err == nil {
+			e.smbstatus = path
+			e.Logger.Printf("Retrieved smbstatus path: %q", e.smbstatus)
+			return
+		}
+	}
+}
+
+// parseSmbstatusJSON parses the output of `smbstatus --json`, available since Samba 4.16
+func parseSmbstatusJSON(output string) (smbStatus, error) {
+	var report struct {
+		Sessions map[string]struct {
+			Username      string `json:"username"`
+			RemoteMachine string `json:"remote_machine"`
+			Dialect       string `json:"session_dialect"`
+		} `json:"sessions"`
+		Tcons map[string]struct {
+			Service string `json:"service"`
+			Machine string `json:"machine"`
+		} `json:"tcons"`
+		OpenFiles map[string]struct {
+			ServicePath string `json:"service_path"`
+		} `json:"open_files"`
+	}
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		return smbStatus{}, fmt.Errorf("parse smbstatus report: %w", err)
+	}
+
+	status := smbStatus{openFiles: make(map[string]int)}
+	for _, s := range report.Sessions {
+		status.sessions = append(status.sessions, smbSession{user: s.Username, client: s.RemoteMachine, protocol: s.Dialect})
+	}
+	for _, t := range report.Tcons {
+		status.connections = append(status.connections, smbConnection{share: t.Service, client: t.Machine})
+	}
+	for _, f := range report.OpenFiles {
+		status.openFiles[f.ServicePath]++
+	}
+
+	return status, nil
+}
+
+// parseSmbstatusText parses the sessions, shares and locked files tables printed by `smbstatus`
+func parseSmbstatusText(output string) smbStatus {
+	status := smbStatus{openFiles: make(map[string]int)}
+	section := ""
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "---") {
+			continue
+		}
+
+		switch fields[0] {
+		case "PID", "Service", "Pid":
+			// Table headers for the sessions, shares and locked files sections
+			section = fields[0]
+			continue
+		case "Samba", "Locked", "No":
+			// "Samba version ...", "Locked files:", "No locked files"
+			continue
+		}
+
+		switch section {
+		case "PID":
+			// PID Username Group Machine [(address)] Protocol Version ...
+			if len(fields) < 5 {
+				continue
+			}
+			protocol := fields[4]
+			if strings.HasPrefix(protocol, "(") && len(fields) > 5 {
+				protocol = fields[5]
+			}
+			status.sessions = append(status.sessions, smbSession{user: fields[1], client: fields[3], protocol: protocol})
+		case "Service":
+			// Service pid Machine Connected at ...
+			if len(fields) < 3 {
+				continue
+			}
+			status.connections = append(status.connections, smbConnection{share: fields[0], client: fields[2]})
+		case "Pid":
+			// Pid User(ID) DenyMode Access R/W Oplock SharePath Name Time
+			if len(fields) < 7 {
+				continue
+			}
+			status.openFiles[fields[6]]++
+		}
+	}
+
+	return status
+}
+
+func (e *promExporter) getSmbMetrics() ([]metric, error) {
+	if e.smbstatus == "" {
+		return nil, nil
+	}
+
+	output, err := utils.ExecCommand(e.smbstatus, "--json")
+	status, jsonErr := parseSmbstatusJSON(output)
+	if err != nil || jsonErr != nil {
+		// Samba versions older than 4.16 do not support --json
+		output, err = utils.ExecCommand(e.smbstatus)
+		if err != nil {
+			return nil, fmt.Errorf("get smb status: %w", err)
+		}
+		status = parseSmbstatusText(output)
+	}
+
+	return smbStatusMetrics(status), nil
+}
+
+func smbStatusMetrics(status smbStatus) []metric {
+	sessions := make(map[string]int)
+	for _, s := range status.sessions {
+		sessions[fmt.Sprintf("protocol=%q,user=%q,client=%q", s.protocol, s.user, s.client)]++
+	}
+	connections := make(map[string]int)
+	for _, c := range status.connections {
+		connections[fmt.Sprintf("share=%q,client=%q", c.share, c.client)]++
+	}
+	openFiles := make(map[string]int, len(status.openFiles))
+	for sharePath, count := range status.openFiles {
+		openFiles[fmt.Sprintf("share_path=%q", sharePath)] = count
+	}
+
+	metrics := make([]metric, 0, len(sessions)+len(connections)+len(openFiles))
+	metrics = appendCountMetrics(metrics, "node_smb_sessions", sessions, "Number of active SMB sessions")
+	metrics = appendCountMetrics(metrics, "node_smb_share_connections", connections, "Number of SMB connections to each share")
+	metrics = appendCountMetrics(metrics, "node_smb_open_files", openFiles, "Number of files open over SMB in each share")
+
+	return metrics
+}
+
+// appendCountMetrics appends one gauge per label set, in a stable order
+func appendCountMetrics(metrics []metric, name string, counts map[string]int, help string) []metric {
+	attrs := make([]string, 0, len(counts))
+	for attr := range counts {
+		attrs = append(attrs, attr)
+	}
+	sort.Strings(attrs)
+
+	for _, attr := range attrs {
+		metrics = append(metrics, metric{
+			name:       name,
+			attr:       attr,
+			value:      float64(counts[attr]),
+			help:       help,
+			metricType: "gauge",
+		})
+	}
+
+	return metrics
+}
@@ -0,0 +1,79 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSmbstatusJSON(t *testing.T) {
+	status, err := parseSmbstatusJSON(`{
+  "timestamp": "2026-10-19T10:00:00.000000+0200",
+  "version": "4.17.12",
+  "smb_conf": "/etc/config/smb.conf",
+  "sessions": {
+    "3117239271": {"session_id": "3117239271", "username": "alice", "groupname": "everyone", "remote_machine": "192.168.1.10", "hostname": "ipv4:192.168.1.10:51234", "session_dialect": "SMB3_11"}
+  },
+  "tcons": {
+    "1": {"service": "Public", "session_id": "3117239271", "machine": "192.168.1.10"},
+    "2": {"service": "Multimedia", "session_id": "3117239271", "machine": "192.168.1.10"}
+  },
+  "open_files": {
+    "/share/CACHEDEV1_DATA/Public/a.txt": {"service_path": "/share/CACHEDEV1_DATA/Public", "filename": "a.txt"},
+    "/share/CACHEDEV1_DATA/Public/b.txt": {"service_path": "/share/CACHEDEV1_DATA/Public", "filename": "b.txt"}
+  }
+}`)
+
+	require.NoError(t, err)
+	assert.Equal(t, []smbSession{{user: "alice", client: "192.168.1.10", protocol: "SMB3_11"}}, status.sessions)
+	assert.ElementsMatch(t, []smbConnection{{share: "Public", client: "192.168.1.10"}, {share: "Multimedia", client: "192.168.1.10"}}, status.connections)
+	assert.Equal(t, map[string]int{"/share/CACHEDEV1_DATA/Public": 2}, status.openFiles)
+
+	_, err = parseSmbstatusJSON("smbstatus: unknown option --json")
+	assert.Error(t, err)
+}
+
+func TestParseSmbstatusText(t *testing.T) {
+	status := parseSmbstatusText(`
+Samba version 4.15.13
+PID     Username     Group        Machine                                   Protocol Version  Encryption           Signing
+----------------------------------------------------------------------------------------------------------------------------------------
+12345   alice        everyone     192.168.1.10 (ipv4:192.168.1.10:51234)    SMB3_11           -                    partial(AES-128-CMAC)
+12346   bob          everyone     192.168.1.11 (ipv4:192.168.1.11:51235)    SMB2_10           -                    -
+
+Service      pid     Machine       Connected at                     Encryption   Signing
+---------------------------------------------------------------------------------------------
+Public       12345   192.168.1.10  Sun Oct 18 10:00:00 AM 2026 CEST -            -
+Public       12346   192.168.1.11  Sun Oct 18 10:05:00 AM 2026 CEST -            -
+
+Locked files:
+Pid          User(ID)   DenyMode   Access      R/W        Oplock           SharePath   Name   Time
+--------------------------------------------------------------------------------------------------
+12345        1000       DENY_NONE  0x100081    RDONLY     NONE             /share/Public   .   Sun Oct 18 10:00:00 2026
+`)
+
+	assert.Equal(t, []smbSession{
+		{user: "alice", client: "192.168.1.10", protocol: "SMB3_11"},
+		{user: "bob", client: "192.168.1.11", protocol: "SMB2_10"},
+	}, status.sessions)
+	assert.Equal(t, []smbConnection{
+		{share: "Public", client: "192.168.1.10"},
+		{share: "Public", client: "192.168.1.11"},
+	}, status.connections)
+	assert.Equal(t, map[string]int{"/share/Public": 1}, status.openFiles)
+}
+
+func TestSmbStatusMetrics(t *testing.T) {
+	metrics := smbStatusMetrics(smbStatus{
+		sessions:    []smbSession{{user: "alice", client: "10.0.0.2", protocol: "SMB3_11"}, {user: "alice", client: "10.0.0.2", protocol: "SMB3_11"}},
+		connections: []smbConnection{{share: "Public", client: "10.0.0.2"}},
+		openFiles:   map[string]int{"/share/Public": 3},
+	})
+
+	assert.Equal(t, []metric{
+		{name: "node_smb_sessions", attr: `protocol="SMB3_11",user="alice",client="10.0.0.2"`, value: 2, help: "Number of active SMB sessions", metricType: "gauge"},
+		{name: "node_smb_share_connections", attr: `share="Public",client="10.0.0.2"`, value: 1, help: "Number of SMB connections to each share", metricType: "gauge"},
+		{name: "node_smb_open_files", attr: `share_path="/share/Public"`, value: 3, help: "Number of files open over SMB in each share", metricType: "gauge"},
+	}, metrics)
+}
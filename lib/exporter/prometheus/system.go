@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pedropombeiro/qnapexporter/lib/utils"
 	"github.com/shirou/gopsutil/v4/host"
@@ -77,6 +78,7 @@ func (e *promExporter) getSysInfoFanMetrics() ([]metric, error) {
 	}
 
 	metrics := make([]metric, 0, e.sysfannum)
+	rootFanStates := e.readRootFanStates()
 
 	for fannum := 1; fannum <= e.sysfannum; fannum++ {
 		fannumStr := strconv.Itoa(fannum)
@@ -86,9 +88,16 @@ func (e *promExporter) getSysInfoFanMetrics() ([]metric, error) {
 			return nil, err
 		}
 
+		// getsysinfo only reports the fan speed, so the status comes from hal_app when it is available
+		status := "unknown"
+		if fannum <= len(rootFanStates) {
+			status = rootFanStates[fannum-1]
+		}
+		metrics = appendStateSetMetrics(metrics, "node_enclosure_fan_status", fmt.Sprintf(`enclosure="root",fan=%q`, fannumStr), "status", enclosureFanStates, status, "Status of the enclosure fans")
+
 		fan, err := strconv.ParseFloat(strings.SplitN(fanStr, " ", 2)[0], 64)
 		if err != nil {
-			return nil, err
+			continue
 		}
 		metrics = append(metrics, metric{
 			name:  "node_sysfan_RPM",
@@ -100,6 +109,26 @@ func (e *promExporter) getSysInfoFanMetrics() ([]metric, error) {
 	return metrics, nil
 }
 
+// readRootFanStates returns the states of the NAS chassis fans, which are only queried from hal_app
+// once per fanStatusValidity as a fan fault does not need to be reported within a scrape interval
+func (e *promExporter) readRootFanStates() []string {
+	if e.chassis.id == "" {
+		return nil
+	}
+	if e.rootFanStates != nil && time.Now().Before(e.rootFanStatesExpiry) {
+		return e.rootFanStates
+	}
+
+	states := make([]string, e.chassis.fanCount)
+	for idx := range states {
+		states[idx] = e.readFanStatus(e.chassis.id, idx).state
+	}
+	e.rootFanStates = states
+	e.rootFanStatesExpiry = time.Now().Add(fanStatusValidity)
+
+	return states
+}
+
 func (e *promExporter) getEnclosureFanMetrics() ([]metric, error) {
 	if e.halApp == "" {
 		return nil, nil
@@ -108,26 +137,20 @@ func (e *promExporter) getEnclosureFanMetrics() ([]metric, error) {
 	metrics := make([]metric, 0, len(e.enclosures))
 
 	for _, enc := range e.enclosures {
-		for fanNum := 0; fanNum < enc.fanCount; fanNum++ {
-			fanOutput, err := utils.ExecCommand(e.halApp, "--se_sys_get_fan", fmt.Sprintf("enc_sys_id=%s,obj_index=%d", enc.id, fanNum))
-			if err != nil {
-				return nil, err
-			}
-
-			matches := fanRpmRe.FindStringSubmatch(fanOutput)
-			if len(matches) < 2 {
-				continue
-			}
+		if !enc.connected {
+			continue
+		}
 
-			fan, err := strconv.ParseFloat(matches[1], 64)
-			if err != nil {
-				return nil, err
+		for fanNum := 0; fanNum < enc.fanCount; fanNum++ {
+			fan := e.readFanStatus(enc.id, fanNum)
+			if fan.hasRPM {
+				metrics = append(metrics, metric{
+					name:  "node_sysfan_RPM",
+					attr:  fmt.Sprintf(`fan="%d",type=%q`, 1+fanNum, enc.name),
+					value: fan.speed,
+				})
 			}
-			metrics = append(metrics, metric{
-				name:  "node_sysfan_RPM",
-				attr:  fmt.Sprintf(`fan="%d",type=%q`, 1+fanNum, enc.name),
-				value: fan,
-			})
+			metrics = appendStateSetMetrics(metrics, "node_enclosure_fan_status", fmt.Sprintf(`enclosure=%q,fan="%d"`, enc.id, 1+fanNum), "status", enclosureFanStates, fan.state, "Status of the enclosure fans")
 		}
 	}
 
@@ -2,21 +2,50 @@ package prometheus
 
 import (
 	"fmt"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/pedropombeiro/qnapexporter/lib/utils"
+	"github.com/shirou/gopsutil/v4/disk"
 )
 
+// volumeStatuses lists the normalized values of `getsysinfo vol_status`
+var volumeStatuses = []string{
+	"ready",
+	"warning",
+	"degraded",
+	"rebuilding",
+	"synchronizing",
+	"migrating",
+	"read_only",
+	"not_active",
+	"unmounted",
+	"error",
+	"unknown",
+}
+
+var volDescDiskVolumeRe = regexp.MustCompile(`^\[(Single|JBOD|RAID\s*\d+) Disk Volume:\s*(.*?)\]?$`)
+
 type volumeInfo struct {
 	index                         string
 	fileSystem                    string
 	description                   string
+	pool                          string
+	raidType                      string
 	status                        string
 	freeSizeBytes, totalSizeBytes float64
 }
 
+// volumeDesc holds the fields parsed from `getsysinfo vol_desc`
+type volumeDesc struct {
+	name     string
+	pool     string
+	raidType string
+}
+
 func (e *promExporter) readSysVolInfo() {
 	volCount := 0
 	sysvolnumOutput, err := utils.ExecCommand(e.getsysinfo, "sysvolnum")
@@ -39,7 +68,8 @@ func (e *promExporter) readSysVolInfo() {
 			e.Logger.Printf("Error fetching volume %d description: %v", idx, err)
 			continue
 		}
-		description := parseVolDesc(desc)
+		parsedDesc := parseVolDesc(desc)
+		description := parsedDesc.name
 		e.Logger.Printf("Retrieved vol_desc %q, parsed to %q", desc, description)
 
 		parsedVolCount++
@@ -70,20 +100,14 @@ func (e *promExporter) readSysVolInfo() {
 			continue
 		}
 
-		status, err := utils.ExecCommand(e.getsysinfo, "vol_status", volIdx)
-		if err != nil {
-			e.Logger.Printf("Error fetching volume %q status: %v", description, err)
-			continue
-		}
-		e.Logger.Printf("Retrieved volume %q vol_status %q", description, status)
-
 		e.volumes = append(
 			e.volumes,
 			volumeInfo{
 				index:          volIdx,
 				description:    description,
+				pool:           parsedDesc.pool,
+				raidType:       parsedDesc.raidType,
 				fileSystem:     fileSystem,
-				status:         status,
 				totalSizeBytes: volsizeBytes,
 			},
 		)
@@ -93,11 +117,15 @@ func (e *promExporter) readSysVolInfo() {
 }
 
 func (e *promExporter) getSysInfoVolMetrics() ([]metric, error) {
-	if e.getsysinfo == "" {
+	if e.genericLinux {
+		return e.getStatfsVolMetrics()
+	}
+	if e.getsysinfo == "" || len(e.volumes) == 0 {
+		// e.g. ZFS hosts, whose pools are reported by the ZFS collector
 		return nil, nil
 	}
 
-	metrics := make([]metric, 0, 2*len(e.volumes))
+	metrics := make([]metric, 0, (3+len(volumeStatuses))*len(e.volumes))
 	e.status.Volumes = []string{}
 
 	expired := e.volumeLastFetch.IsZero() || time.Now().After(e.volumeLastFetch.Add(volumeValidity))
@@ -122,37 +150,136 @@ func (e *promExporter) getSysInfoVolMetrics() ([]metric, error) {
 			e.volumes[idx] = v
 		}
 
-		attr := fmt.Sprintf("volume=%q,filesystem=%q,status=%q", v.description, v.fileSystem, v.status)
-		newMetrics := []metric{
-			{
-				name:  "node_volume_avail_bytes",
-				attr:  attr,
-				value: v.freeSizeBytes,
-			},
-			{
-				name:  "node_volume_size_bytes",
-				attr:  attr,
-				value: v.totalSizeBytes,
-			},
+		if expired || v.status == "" {
+			status, err := utils.ExecCommand(e.getsysinfo, "vol_status", v.index)
+			if err != nil {
+				e.Logger.Printf("Error fetching volume %q status: %v", v.description, err)
+				continue
+			}
+
+			v.status = status
+			e.volumes[idx] = v
 		}
-		metrics = append(metrics, newMetrics...)
+
+		metrics = append(metrics, volumeMetrics(v)...)
 	}
 
 	return metrics, nil
 }
 
-func parseVolDesc(desc string) string {
-	var index int
-	switch {
-	case strings.HasPrefix(desc, "[Volume"):
-		index = 8
-	case strings.HasPrefix(desc, "[Single Disk Volume:"):
-		return ""
-	default:
-		return desc
+// getStatfsVolMetrics reports the mounted block device file systems as volumes, on hosts without getsysinfo
+func (e *promExporter) getStatfsVolMetrics() ([]metric, error) {
+	partitions, err := disk.Partitions(false)
+	if err != nil {
+		return nil, err
+	}
+
+	volumes := []string{}
+	metrics := make([]metric, 0, (3+len(volumeStatuses))*len(partitions))
+	seen := make(map[string]bool, len(partitions))
+	for _, p := range partitions {
+		// Skip pseudo file systems and additional mounts of the same device (e.g. btrfs subvolumes, bind mounts)
+		if !strings.HasPrefix(p.Device, "/dev/") || seen[p.Device] {
+			continue
+		}
+		seen[p.Device] = true
+
+		usage, err := disk.Usage(p.Mountpoint)
+		if err != nil {
+			e.Logger.Printf("Error fetching volume %q usage: %v", p.Mountpoint, err)
+			continue
+		}
+
+		status := "ready"
+		if slices.Contains(p.Opts, "ro") {
+			status = "read_only"
+		}
+
+		v := volumeInfo{
+			description:    p.Mountpoint,
+			fileSystem:     p.Fstype,
+			status:         status,
+			freeSizeBytes:  float64(usage.Free),
+			totalSizeBytes: float64(usage.Total),
+		}
+		volumes = append(volumes, v.description)
+		metrics = append(metrics, volumeMetrics(v)...)
+	}
+
+	if e.status != nil {
+		e.status.Volumes = volumes
+	}
+
+	return metrics, nil
+}
+
+func volumeMetrics(v volumeInfo) []metric {
+	attr := fmt.Sprintf("volume=%q,filesystem=%q", v.description, v.fileSystem)
+	// The raw status label is kept for the v1 schema, and dropped in v2 in favor of node_volume_status
+	usageAttr := fmt.Sprintf("%s,status=%q", attr, v.status)
+	metrics := []metric{
+		{
+			name:  "node_volume_avail_bytes",
+			attr:  usageAttr,
+			value: v.freeSizeBytes,
+		},
+		{
+			name:  "node_volume_size_bytes",
+			attr:  usageAttr,
+			value: v.totalSizeBytes,
+		},
+		{
+			name:       "node_volume_info",
+			attr:       fmt.Sprintf("%s,pool=%q,raid_type=%q", attr, v.pool, v.raidType),
+			value:      1,
+			help:       "Storage pool, RAID type and file system of the volume",
+			metricType: "gauge",
+		},
+	}
+
+	return appendStateSetMetrics(
+		metrics, "node_volume_status", fmt.Sprintf("volume=%q", v.description), "status",
+		volumeStatuses, parseVolStatus(v.status), "Status of the volume",
+	)
+}
+
+// parseVolDesc parses the volume descriptions reported by getsysinfo, e.g.
+// "[Volume DataVol1, Pool 1]" or "[Single Disk Volume: Drive 1]"
+func parseVolDesc(desc string) volumeDesc {
+	if strings.HasPrefix(desc, "[Volume") {
+		tokens := strings.SplitN(strings.TrimSpace(desc[8:]), ",", 2)
+		d := volumeDesc{name: strings.TrimSuffix(tokens[0], "]")}
+		if len(tokens) == 2 {
+			pool := strings.TrimSuffix(strings.TrimSpace(tokens[1]), "]")
+			d.pool = strings.TrimSpace(strings.TrimPrefix(pool, "Pool"))
+		}
+
+		return d
+	}
+
+	if matches := volDescDiskVolumeRe.FindStringSubmatch(desc); matches != nil {
+		// Static volumes are not part of a storage pool, and report their RAID type instead
+		raidType := strings.ToLower(strings.ReplaceAll(matches[1], " ", ""))
+		return volumeDesc{
+			name:     strings.TrimSuffix(strings.TrimPrefix(desc, "["), "]"),
+			raidType: raidType,
+		}
+	}
+
+	return volumeDesc{name: desc}
+}
+
+// parseVolStatus normalizes the output of `getsysinfo vol_status` to one of volumeStatuses
+func parseVolStatus(status string) string {
+	s := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(status)), " ", "_")
+	s = strings.ReplaceAll(s, "-", "_")
+	for _, state := range volumeStatuses {
+		if s == state || strings.HasPrefix(s, state+"_") {
+			return state
+		}
 	}
 
-	return strings.SplitN(strings.TrimSpace(desc[index:]), ",", 2)[0]
+	return "unknown"
 }
 
 func parseVolSize(s string) (float64, error) {
@@ -0,0 +1,79 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVolDesc(t *testing.T) {
+	tests := []struct {
+		desc string
+		want volumeDesc
+	}{
+		{desc: "[Volume DataVol1, Pool 1]", want: volumeDesc{name: "DataVol1", pool: "1"}},
+		{desc: "[Volume System_Vol]", want: volumeDesc{name: "System_Vol"}},
+		{desc: "[Single Disk Volume: Drive 3]", want: volumeDesc{name: "Single Disk Volume: Drive 3", raidType: "single"}},
+		{desc: "[RAID 5 Disk Volume: Drive 1 2 3 4]", want: volumeDesc{name: "RAID 5 Disk Volume: Drive 1 2 3 4", raidType: "raid5"}},
+		{desc: "[JBOD Disk Volume: Drive 1 2]", want: volumeDesc{name: "JBOD Disk Volume: Drive 1 2", raidType: "jbod"}},
+		{desc: "Backup", want: volumeDesc{name: "Backup"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseVolDesc(tt.desc))
+		})
+	}
+}
+
+func TestParseVolStatus(t *testing.T) {
+	tests := map[string]string{
+		"Ready":            "ready",
+		"Degraded":         "degraded",
+		"Rebuilding (42%)": "rebuilding",
+		"Read only":        "read_only",
+		"Not active":       "not_active",
+		"Something else":   "unknown",
+	}
+
+	for status, want := range tests {
+		t.Run(status, func(t *testing.T) {
+			assert.Equal(t, want, parseVolStatus(status))
+		})
+	}
+}
+
+func TestVolumeStatusMetrics(t *testing.T) {
+	metrics := appendStateSetMetrics(nil, "node_volume_status", `volume="DataVol1"`, "status", volumeStatuses, parseVolStatus("Degraded"), "")
+
+	assert.Len(t, metrics, len(volumeStatuses))
+	for _, m := range metrics {
+		if m.attr == `volume="DataVol1",status="degraded"` {
+			assert.Equal(t, 1.0, m.value)
+		} else {
+			assert.Zero(t, m.value, m.attr)
+		}
+	}
+}
+
+func TestVolumeMetrics(t *testing.T) {
+	metrics := volumeMetrics(volumeInfo{
+		description:    "/srv/data",
+		fileSystem:     "ext4",
+		status:         "read_only",
+		freeSizeBytes:  100,
+		totalSizeBytes: 400,
+	})
+
+	assert.Len(t, metrics, 3+len(volumeStatuses))
+	assert.Equal(t, metric{name: "node_volume_avail_bytes", attr: `volume="/srv/data",filesystem="ext4",status="read_only"`, value: 100}, metrics[0])
+	assert.Equal(t, metric{name: "node_volume_size_bytes", attr: `volume="/srv/data",filesystem="ext4",status="read_only"`, value: 400}, metrics[1])
+	assert.Equal(t, `volume="/srv/data",filesystem="ext4",pool="",raid_type=""`, metrics[2].attr)
+	for _, m := range metrics[3:] {
+		if m.attr == `volume="/srv/data",status="read_only"` {
+			assert.Equal(t, 1.0, m.value)
+		} else {
+			assert.Zero(t, m.value, m.attr)
+		}
+	}
+}
@@ -0,0 +1,524 @@
+package prometheus
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pedropombeiro/qnapexporter/lib/utils"
+)
+
+const zfsKstatDir = "/proc/spl/kstat/zfs"
+
+var (
+	zpoolListFields = []string{"name", "size", "alloc", "free", "frag", "dedupratio", "health"}
+	zfsListFields   = []string{"name", "used", "avail", "refer", "quota", "compressratio"}
+
+	// zpoolHealthStates lists the health states reported by `zpool list`
+	zpoolHealthStates = []string{"ONLINE", "DEGRADED", "FAULTED", "OFFLINE", "UNAVAIL", "REMOVED", "SUSPENDED"}
+
+	zpoolScanProgressRe = regexp.MustCompile(`([\d.]+)% done`)
+	zpoolScanErrorsRe   = regexp.MustCompile(`with (\d+) errors`)
+	zpoolDataErrorsRe   = regexp.MustCompile(`^errors:\s*(\d+) data errors`)
+)
+
+// zpoolInfo holds the properties of a pool as reported by `zpool list`
+type zpoolInfo struct {
+	name               string
+	sizeBytes          float64
+	allocatedBytes     float64
+	freeBytes          float64
+	fragmentationRatio float64
+	dedupRatio         float64
+	health             string
+}
+
+// zpoolStatus holds the scrub and error information of a pool as reported by `zpool status`
+type zpoolStatus struct {
+	name           string
+	scrubActive    bool
+	scrubCompleted float64
+	scanErrors     float64
+	dataErrors     float64
+	readErrors     float64
+	writeErrors    float64
+	checksumErrors float64
+}
+
+// zfsDataset holds the properties of a dataset as reported by `zfs list`
+type zfsDataset struct {
+	name             string
+	usedBytes        float64
+	availableBytes   float64
+	referencedBytes  float64
+	quotaBytes       float64
+	compressionRatio float64
+}
+
+func (e *promExporter) readZfsPaths() {
+	if e.zpool == "" {
+		e.zpool, _ = exec.LookPath("zpool")
+		if e.zpool != "" {
+			e.Logger.Printf("Retrieved zpool path: %q", e.zpool)
+		}
+	}
+	if e.zfs == "" {
+		e.zfs, _ = exec.LookPath("zfs")
+	}
+}
+
+func (e *promExporter) getZfsMetrics() ([]metric, error) {
+	metrics := make([]metric, 0, 64)
+
+	arcstats, err := utils.ReadFile(path.Join(zfsKstatDir, "arcstats"))
+	if err == nil {
+		metrics = append(metrics, zfsArcMetrics(parseKstat(arcstats))...)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if e.zpool == "" {
+		return metrics, nil
+	}
+
+	// A failing command is logged, keeping the metrics read from the other sources
+	lines, err := utils.ExecCommandGetLines(e.zpool, "list", "-Hp", "-o", strings.Join(zpoolListFields, ","))
+	if err != nil {
+		e.Logger.Printf("Error listing zfs pools: %v", err)
+	}
+	for _, pool := range parseZpoolList(lines) {
+		metrics = append(metrics, zpoolMetrics(pool)...)
+		metrics = append(metrics, zpoolIOMetrics(zfsKstatDir, pool.name)...)
+	}
+
+	output, err := utils.ExecCommand(e.zpool, "status", "-p")
+	if err != nil {
+		e.Logger.Printf("Error getting zfs pool status: %v", err)
+	}
+	for _, status := range parseZpoolStatus(output) {
+		metrics = append(metrics, zpoolStatusMetrics(status)...)
+	}
+
+	if e.zfs == "" {
+		return metrics, nil
+	}
+
+	lines, err = utils.ExecCommandGetLines(e.zfs, "list", "-Hp", "-t", "filesystem,volume", "-o", strings.Join(zfsListFields, ","))
+	if err != nil {
+		e.Logger.Printf("Error listing zfs datasets: %v", err)
+	}
+	for _, dataset := range parseZfsList(lines) {
+		metrics = append(metrics, zfsDatasetMetrics(dataset)...)
+	}
+
+	return metrics, nil
+}
+
+// parseKstat parses a named kstat file such as /proc/spl/kstat/zfs/arcstats, which lists
+// one "<name> <type> <data>" entry per line after a two-line header
+func parseKstat(content string) map[string]float64 {
+	values := make(map[string]float64)
+	lines := strings.Split(content, "\n")
+	if len(lines) < 2 {
+		return values
+	}
+
+	for _, line := range lines[2:] {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+
+		if v, err := strconv.ParseFloat(fields[2], 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+
+	return values
+}
+
+// parseKstatIO parses a pool io kstat, which lists the column names and values on the lines after the header
+func parseKstatIO(content string) map[string]float64 {
+	values := make(map[string]float64)
+	lines := strings.Split(content, "\n")
+	if len(lines) < 3 {
+		return values
+	}
+
+	names := strings.Fields(lines[1])
+	data := strings.Fields(lines[2])
+	for idx, name := range names {
+		if idx >= len(data) {
+			break
+		}
+		if v, err := strconv.ParseFloat(data[idx], 64); err == nil {
+			values[name] = v
+		}
+	}
+
+	return values
+}
+
+// parseZfsNumber parses the numbers printed by `zpool list -p` and `zfs list -p`, which may carry
+// a unit suffix (e.g. "1.00x", "12%") or be "-" when not applicable
+func parseZfsNumber(s string) float64 {
+	v, _ := strconv.ParseFloat(strings.TrimRight(s, "x%"), 64)
+	return v
+}
+
+func parseZpoolList(lines []string) []zpoolInfo {
+	pools := make([]zpoolInfo, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Split(line, "\t")
+		if len(fields) != len(zpoolListFields) {
+			continue
+		}
+
+		pools = append(pools, zpoolInfo{
+			name:               fields[0],
+			sizeBytes:          parseZfsNumber(fields[1]),
+			allocatedBytes:     parseZfsNumber(fields[2]),
+			freeBytes:          parseZfsNumber(fields[3]),
+			fragmentationRatio: parseZfsNumber(fields[4]) / 100,
+			dedupRatio:         parseZfsNumber(fields[5]),
+			health:             fields[6],
+		})
+	}
+
+	return pools
+}
+
+// parseZpoolStatus parses the output of `zpool status -p` for all pools
+func parseZpoolStatus(output string) []zpoolStatus {
+	var pools []zpoolStatus
+	var current *zpoolStatus
+	inConfig := false
+	for _, line := range strings.Split(output, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "pool:"):
+			pools = append(pools, zpoolStatus{name: strings.TrimSpace(strings.TrimPrefix(trimmed, "pool:"))})
+			current = &pools[len(pools)-1]
+			inConfig = false
+			continue
+		case current == nil:
+			continue
+		case strings.HasPrefix(trimmed, "scan:"):
+			current.scrubActive = strings.Contains(trimmed, "scrub in progress")
+			if matches := zpoolScanErrorsRe.FindStringSubmatch(trimmed); matches != nil {
+				current.scanErrors, _ = strconv.ParseFloat(matches[1], 64)
+			}
+			if strings.Contains(trimmed, "scrub repaired") {
+				current.scrubCompleted = 1
+			}
+		case strings.HasPrefix(trimmed, "config:"):
+			inConfig = true
+		case strings.HasPrefix(trimmed, "errors:"):
+			inConfig = false
+			if matches := zpoolDataErrorsRe.FindStringSubmatch(trimmed); matches != nil {
+				current.dataErrors, _ = strconv.ParseFloat(matches[1], 64)
+			}
+		case current.scrubActive && zpoolScanProgressRe.MatchString(trimmed):
+			progress, _ := strconv.ParseFloat(zpoolScanProgressRe.FindStringSubmatch(trimmed)[1], 64)
+			current.scrubCompleted = progress / 100
+		case inConfig:
+			// NAME STATE READ WRITE CKSUM, where the pool itself is the first row
+			fields := strings.Fields(trimmed)
+			if len(fields) < 5 || fields[0] != current.name {
+				continue
+			}
+			current.readErrors = parseZfsNumber(fields[2])
+			current.writeErrors = parseZfsNumber(fields[3])
+			current.checksumErrors = parseZfsNumber(fields[4])
+		}
+	}
+
+	return pools
+}
+
+func parseZfsList(lines []string) []zfsDataset {
+	datasets := make([]zfsDataset, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Split(line, "\t")
+		if len(fields) != len(zfsListFields) {
+			continue
+		}
+
+		datasets = append(datasets, zfsDataset{
+			name:             fields[0],
+			usedBytes:        parseZfsNumber(fields[1]),
+			availableBytes:   parseZfsNumber(fields[2]),
+			referencedBytes:  parseZfsNumber(fields[3]),
+			quotaBytes:       parseZfsNumber(fields[4]),
+			compressionRatio: parseZfsNumber(fields[5]),
+		})
+	}
+
+	return datasets
+}
+
+func hitRatio(hits, misses float64) float64 {
+	if hits+misses == 0 {
+		return 0
+	}
+
+	return hits / (hits + misses)
+}
+
+func zfsArcMetrics(arc map[string]float64) []metric {
+	if len(arc) == 0 {
+		return nil
+	}
+
+	return []metric{
+		{
+			name:       "node_zfs_arc_size_bytes",
+			value:      arc["size"],
+			help:       "Current size of the ARC",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_zfs_arc_target_size_bytes",
+			value:      arc["c"],
+			help:       "Target size of the ARC",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_zfs_arc_max_size_bytes",
+			value:      arc["c_max"],
+			help:       "Maximum size of the ARC",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_zfs_arc_hits_total",
+			value:      arc["hits"],
+			help:       "Number of ARC hits",
+			metricType: "counter",
+		},
+		{
+			name:       "node_zfs_arc_misses_total",
+			value:      arc["misses"],
+			help:       "Number of ARC misses",
+			metricType: "counter",
+		},
+		{
+			name:       "node_zfs_arc_hit_ratio",
+			value:      hitRatio(arc["hits"], arc["misses"]),
+			help:       "Ratio of ARC hits since boot",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_zfs_l2arc_size_bytes",
+			value:      arc["l2_size"],
+			help:       "Size of the data in the L2ARC",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_zfs_l2arc_hits_total",
+			value:      arc["l2_hits"],
+			help:       "Number of L2ARC hits",
+			metricType: "counter",
+		},
+		{
+			name:       "node_zfs_l2arc_misses_total",
+			value:      arc["l2_misses"],
+			help:       "Number of L2ARC misses",
+			metricType: "counter",
+		},
+		{
+			name:       "node_zfs_l2arc_hit_ratio",
+			value:      hitRatio(arc["l2_hits"], arc["l2_misses"]),
+			help:       "Ratio of L2ARC hits since boot",
+			metricType: "gauge",
+		},
+	}
+}
+
+func zpoolMetrics(p zpoolInfo) []metric {
+	attr := fmt.Sprintf("pool=%q", p.name)
+	metrics := []metric{
+		{
+			name:       "node_zfs_pool_size_bytes",
+			attr:       attr,
+			value:      p.sizeBytes,
+			help:       "Size of the ZFS pool",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_zfs_pool_allocated_bytes",
+			attr:       attr,
+			value:      p.allocatedBytes,
+			help:       "Space allocated in the ZFS pool",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_zfs_pool_free_bytes",
+			attr:       attr,
+			value:      p.freeBytes,
+			help:       "Free space in the ZFS pool",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_zfs_pool_fragmentation_ratio",
+			attr:       attr,
+			value:      p.fragmentationRatio,
+			help:       "Fragmentation of the free space in the ZFS pool",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_zfs_pool_dedup_ratio",
+			attr:       attr,
+			value:      p.dedupRatio,
+			help:       "Deduplication ratio of the ZFS pool",
+			metricType: "gauge",
+		},
+	}
+
+	return appendStateSetMetrics(metrics, "node_zfs_pool_health", attr, "health", zpoolHealthStates, p.health, "Health of the ZFS pool")
+}
+
+// zpoolIOMetrics reads the I/O statistics of a pool, which are only exposed by older ZFS versions
+func zpoolIOMetrics(root, pool string) []metric {
+	content, err := utils.ReadFile(path.Join(root, pool, "io"))
+	if err != nil {
+		return nil
+	}
+
+	io := parseKstatIO(content)
+	attr := fmt.Sprintf("pool=%q", pool)
+	return []metric{
+		{
+			name:       "node_zfs_pool_read_bytes_total",
+			attr:       attr,
+			value:      io["nread"],
+			help:       "Number of bytes read from the ZFS pool",
+			metricType: "counter",
+		},
+		{
+			name:       "node_zfs_pool_written_bytes_total",
+			attr:       attr,
+			value:      io["nwritten"],
+			help:       "Number of bytes written to the ZFS pool",
+			metricType: "counter",
+		},
+		{
+			name:       "node_zfs_pool_reads_total",
+			attr:       attr,
+			value:      io["reads"],
+			help:       "Number of read operations on the ZFS pool",
+			metricType: "counter",
+		},
+		{
+			name:       "node_zfs_pool_writes_total",
+			attr:       attr,
+			value:      io["writes"],
+			help:       "Number of write operations on the ZFS pool",
+			metricType: "counter",
+		},
+	}
+}
+
+func zpoolStatusMetrics(s zpoolStatus) []metric {
+	attr := fmt.Sprintf("pool=%q", s.name)
+	scrubActive := 0.0
+	if s.scrubActive {
+		scrubActive = 1
+	}
+
+	return []metric{
+		{
+			name:       "node_zfs_pool_scrub_active",
+			attr:       attr,
+			value:      scrubActive,
+			help:       "Whether a scrub is running on the ZFS pool",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_zfs_pool_scrub_completed_ratio",
+			attr:       attr,
+			value:      s.scrubCompleted,
+			help:       "Progress of the current scrub of the ZFS pool",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_zfs_pool_scrub_errors",
+			attr:       attr,
+			value:      s.scanErrors,
+			help:       "Number of errors found by the last scrub of the ZFS pool",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_zfs_pool_data_errors",
+			attr:       attr,
+			value:      s.dataErrors,
+			help:       "Number of known data errors in the ZFS pool",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_zfs_pool_vdev_errors",
+			attr:       attr + `,type="read"`,
+			value:      s.readErrors,
+			help:       "Number of I/O errors reported by the ZFS pool devices",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_zfs_pool_vdev_errors",
+			attr:       attr + `,type="write"`,
+			value:      s.writeErrors,
+			help:       "Number of I/O errors reported by the ZFS pool devices",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_zfs_pool_vdev_errors",
+			attr:       attr + `,type="checksum"`,
+			value:      s.checksumErrors,
+			help:       "Number of I/O errors reported by the ZFS pool devices",
+			metricType: "gauge",
+		},
+	}
+}
+
+func zfsDatasetMetrics(d zfsDataset) []metric {
+	attr := fmt.Sprintf("dataset=%q", d.name)
+	return []metric{
+		{
+			name:       "node_zfs_dataset_used_bytes",
+			attr:       attr,
+			value:      d.usedBytes,
+			help:       "Space used by the ZFS dataset and its descendants",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_zfs_dataset_available_bytes",
+			attr:       attr,
+			value:      d.availableBytes,
+			help:       "Space available to the ZFS dataset",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_zfs_dataset_referenced_bytes",
+			attr:       attr,
+			value:      d.referencedBytes,
+			help:       "Space referenced by the ZFS dataset",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_zfs_dataset_quota_bytes",
+			attr:       attr,
+			value:      d.quotaBytes,
+			help:       "Quota of the ZFS dataset, 0 if none",
+			metricType: "gauge",
+		},
+		{
+			name:       "node_zfs_dataset_compression_ratio",
+			attr:       attr,
+			value:      d.compressionRatio,
+			help:       "Compression ratio achieved for the ZFS dataset",
+			metricType: "gauge",
+		},
+	}
+}
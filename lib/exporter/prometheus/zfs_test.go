@@ -0,0 +1,127 @@
+package prometheus
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKstat(t *testing.T) {
+	arc := parseKstat(`13 1 0x01 123 33456 4217433452 1023459823475
+name                            type data
+hits                            4    900
+misses                          4    100
+c                               4    4294967296
+c_max                           4    8589934592
+size                            4    4000000000
+l2_hits                         4    30
+l2_misses                       4    70
+l2_size                         4    1000000000
+`)
+
+	assert.Equal(t, 900.0, arc["hits"])
+	assert.Equal(t, 8589934592.0, arc["c_max"])
+
+	metrics := zfsArcMetrics(arc)
+	require.Len(t, metrics, 10)
+	assert.Equal(t, metric{name: "node_zfs_arc_hit_ratio", value: 0.9, help: "Ratio of ARC hits since boot", metricType: "gauge"}, metrics[5])
+	assert.Equal(t, "node_zfs_l2arc_hit_ratio", metrics[9].name)
+	assert.InDelta(t, 0.3, metrics[9].value, 1e-9)
+
+	assert.Empty(t, zfsArcMetrics(parseKstat("")))
+}
+
+func TestParseKstatIO(t *testing.T) {
+	io := parseKstatIO(`12 3 0x00 1 80 2237237612 1023459823475
+nread    nwritten   reads    writes   wtime    wlentime wupdate  rtime    rlentime rupdate  wcnt     rcnt
+1024     2048       10       20       0        0        0        0        0        0        0        0
+`)
+
+	assert.Equal(t, map[string]float64{
+		"nread": 1024, "nwritten": 2048, "reads": 10, "writes": 20,
+		"wtime": 0, "wlentime": 0, "wupdate": 0, "rtime": 0, "rlentime": 0, "rupdate": 0, "wcnt": 0, "rcnt": 0,
+	}, io)
+}
+
+func TestParseZpoolList(t *testing.T) {
+	pools := parseZpoolList([]string{
+		"zpool1\t7971459301376\t3985729650688\t3985729650688\t12\t1.00x\tONLINE",
+		"zpool2\t1000\t900\t100\t-\t1.25\tDEGRADED",
+		"garbage",
+	})
+
+	assert.Equal(t, []zpoolInfo{
+		{name: "zpool1", sizeBytes: 7971459301376, allocatedBytes: 3985729650688, freeBytes: 3985729650688, fragmentationRatio: 0.12, dedupRatio: 1, health: "ONLINE"},
+		{name: "zpool2", sizeBytes: 1000, allocatedBytes: 900, freeBytes: 100, dedupRatio: 1.25, health: "DEGRADED"},
+	}, pools)
+}
+
+func TestParseZpoolStatus(t *testing.T) {
+	pools := parseZpoolStatus(`  pool: zpool1
+ state: ONLINE
+  scan: scrub in progress since Sun Oct 11 00:24:01 2026
+	1.23T scanned at 1.2G/s, 800G issued at 800M/s, 2.00T total
+	0B repaired, 40.00% done, 00:25:00 to go
+config:
+
+	NAME                                        STATE     READ WRITE CKSUM
+	zpool1                                      ONLINE       0     0     0
+	  mirror-0                                  ONLINE       0     0     0
+	    qzfs/enc_0/disk_0x1_5000C500B3A0C1B2_3  ONLINE       0     0     0
+	    qzfs/enc_0/disk_0x2_5000C500B3A0C1B3_3  ONLINE       0     0     0
+
+errors: No known data errors
+
+  pool: zpool2
+ state: DEGRADED
+  scan: scrub repaired 0B in 02:13:45 with 2 errors on Sun Oct  4 02:37:46 2026
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	zpool2      DEGRADED     1     0     5
+	  sdc       FAULTED      1     0     5
+
+errors: 3 data errors, use '-v' for a list
+`)
+
+	require.Len(t, pools, 2)
+	assert.Equal(t, zpoolStatus{name: "zpool1", scrubActive: true, scrubCompleted: 0.4}, pools[0])
+	assert.Equal(t, zpoolStatus{
+		name:           "zpool2",
+		scrubCompleted: 1,
+		scanErrors:     2,
+		dataErrors:     3,
+		readErrors:     1,
+		checksumErrors: 5,
+	}, pools[1])
+}
+
+func TestParseZfsList(t *testing.T) {
+	datasets := parseZfsList([]string{
+		"zpool1/zfs1\t1099511627776\t2199023255552\t1099511627776\t0\t1.52x",
+		"zpool1/zfs2\t1024\t2048\t512\t4096\t1.00",
+	})
+
+	assert.Equal(t, []zfsDataset{
+		{name: "zpool1/zfs1", usedBytes: 1099511627776, availableBytes: 2199023255552, referencedBytes: 1099511627776, compressionRatio: 1.52},
+		{name: "zpool1/zfs2", usedBytes: 1024, availableBytes: 2048, referencedBytes: 512, quotaBytes: 4096, compressionRatio: 1},
+	}, datasets)
+}
+
+func TestGetZfsMetricsLogsFailingCommands(t *testing.T) {
+	var logs bytes.Buffer
+	e := &promExporter{
+		ExporterConfig: ExporterConfig{Logger: log.New(&logs, "", 0)},
+		zpool:          "/nonexistent/zpool",
+		zfs:            "/nonexistent/zfs",
+	}
+
+	_, err := e.getZfsMetrics()
+	require.NoError(t, err)
+	assert.Contains(t, logs.String(), "Error listing zfs pools")
+	assert.Contains(t, logs.String(), "Error getting zfs pool status")
+	assert.Contains(t, logs.String(), "Error listing zfs datasets")
+}
@@ -1,14 +1,9 @@
-// Package notifications posts annotations to Grafana, optionally matching them
-// to regions and extracting tags from notification text.
+// Package notifications posts annotations to sinks such as Grafana, optionally
+// matching them to regions and extracting tags from notification text.
 package notifications
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"time"
 
 	"github.com/pedropombeiro/qnapexporter/lib/notifications/tagextractor"
@@ -20,18 +15,6 @@ type Annotator interface {
 	Post(annotation string, time time.Time) (int, error)
 }
 
-type grafanaAnnotation struct {
-	ID      int      `json:"id,omitempty"`
-	Tags    []string `json:"tags,omitempty"`
-	Time    int64    `json:"time,omitempty"`
-	TimeEnd int64    `json:"timeEnd,omitempty"`
-	Text    string   `json:"text,omitempty"`
-}
-
-type httpClient interface {
-	Do(req *http.Request) (*http.Response, error)
-}
-
 // NewSimpleAnnotator returns an Annotator that posts each annotation to Grafana
 // without region matching or tag extraction.
 func NewSimpleAnnotator(
@@ -40,29 +23,23 @@ func NewSimpleAnnotator(
 	c httpClient,
 	logger *log.Logger,
 ) Annotator {
-	if len(tags) == 1 && tags[0] == "" {
-		tags = nil
-	}
-
-	return &regionMatchingAnnotator{
-		grafanaURL:       grafanaURL,
-		grafanaAuthToken: grafanaAuthToken,
-		tags:             tags,
-		tagExtractor:     tagextractor.NewNoOpTagExtractor(),
-		cache:            NewNoOpRegionMatcher(),
-		client:           c,
-		logger:           logger,
-	}
+	return NewAnnotator(
+		"",
+		NewGrafanaSink(grafanaURL, grafanaAuthToken, c, logger),
+		tags,
+		tagextractor.NewNoOpTagExtractor(),
+		NewNoOpRegionMatcher(),
+		logger,
+	)
 }
 
 type regionMatchingAnnotator struct {
-	grafanaURL       string
-	grafanaAuthToken string
-	tags             []string
-	tagExtractor     tagextractor.TagExtractor
-	cache            RegionMatcher
-	client           httpClient
-	logger           *log.Logger
+	source       string
+	tags         []string
+	tagExtractor tagextractor.TagExtractor
+	cache        RegionMatcher
+	sink         Sink
+	logger       *log.Logger
 }
 
 // NewRegionMatchingAnnotator returns an Annotator that extracts tags and matches
@@ -75,89 +52,57 @@ func NewRegionMatchingAnnotator(
 	cache RegionMatcher,
 	c httpClient,
 	logger *log.Logger,
+) Annotator {
+	return NewAnnotator("", NewGrafanaSink(grafanaURL, grafanaAuthToken, c, logger), tags, tagExtractor, cache, logger)
+}
+
+// NewAnnotator returns an Annotator that extracts tags and matches annotations
+// to regions, storing the annotations from the given source in sink.
+func NewAnnotator(
+	source string,
+	sink Sink,
+	tags []string,
+	tagExtractor tagextractor.TagExtractor,
+	cache RegionMatcher,
+	logger *log.Logger,
 ) Annotator {
 	if len(tags) == 1 && tags[0] == "" {
 		tags = nil
 	}
 
 	return &regionMatchingAnnotator{
-		grafanaURL:       grafanaURL,
-		grafanaAuthToken: grafanaAuthToken,
-		tags:             tags,
-		tagExtractor:     tagExtractor,
-		cache:            cache,
-		client:           c,
-		logger:           logger,
+		source:       source,
+		tags:         tags,
+		tagExtractor: tagExtractor,
+		cache:        cache,
+		sink:         sink,
+		logger:       logger,
 	}
 }
 
 func (a *regionMatchingAnnotator) Post(annotation string, time time.Time) (int, error) {
-	url := fmt.Sprintf("%s/api/annotations", a.grafanaURL)
 	trimmedAnnotation, annotationTags := a.tagExtractor.Extract(annotation)
-	ga := grafanaAnnotation{
-		Text: trimmedAnnotation,
-		Tags: mergeTags(a.tags, annotationTags),
-		Time: time.UnixNano() / 1000000,
+	an := Annotation{
+		Text:   trimmedAnnotation,
+		Tags:   mergeTags(a.tags, annotationTags),
+		Source: a.source,
+		Time:   time,
 	}
-	id := a.cache.Match(annotation)
 
-	reqType := "POST"
-	if id != -1 {
-		reqType = "PATCH"
-		ga.Time = 0
-		ga.TimeEnd = time.UnixNano() / 1000000
-		url = fmt.Sprintf("%s/%d", url, id)
+	if id := a.cache.Match(annotation); id != -1 {
+		an.TimeEnd = time
+		return a.sink.Update(id, an)
 	}
 
-	jsonBytes, err := json.Marshal(ga)
-	if err != nil {
-		a.logger.Printf("Error marshalling Grafana annotation: %v\n", err)
-		return -1, err
-	}
-	bodyReader := bytes.NewReader(jsonBytes)
-	req, err := http.NewRequest(reqType, url, bodyReader)
+	id, err := a.sink.Create(an)
 	if err != nil {
-		a.logger.Printf("Error creating Grafana annotation request: %v\n", err)
 		return -1, err
 	}
-
-	req.Header.Set("Content-Type", "application/json")
-	if a.grafanaAuthToken != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", a.grafanaAuthToken))
-	}
-
-	resp, err := a.client.Do(req)
-	if err == nil {
-		if resp.StatusCode < 300 {
-			body, readErr := io.ReadAll(resp.Body)
-			if readErr != nil {
-				return -1, fmt.Errorf("reading response body: %w", readErr)
-			}
-
-			var response struct {
-				ID      int    `json:"id"`
-				Message string `json:"message"`
-			}
-			err = json.Unmarshal(body, &response)
-			if err != nil {
-				return -1, fmt.Errorf("unmarshaling response body: %w", err)
-			}
-
-			if id == -1 {
-				a.cache.Add(response.ID, annotation)
-			}
-
-			a.logger.Printf("%s (status: %q), ID: %d\n", response.Message, resp.Status, response.ID)
-			return response.ID, nil
-		}
-
-		a.logger.Printf("Error creating Grafana annotation at %s: HTTP %d %q\n", url, resp.StatusCode, resp.Status)
-		err = fmt.Errorf("call to %s failed with HTTP %d %q", url, resp.StatusCode, resp.Status)
-	} else {
-		a.logger.Printf("Error creating Grafana annotation at %s: %v\n", url, err)
+	if id != -1 {
+		a.cache.Add(id, annotation)
 	}
 
-	return -1, err
+	return id, nil
 }
 
 func mergeTags(t1 []string, t2 []string) []string {
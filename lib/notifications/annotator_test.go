@@ -282,3 +282,35 @@ func TestMergeTags(t *testing.T) {
 	tags = mergeTags([]string{"tag1", "tag2"}, []string{"tag2", "tag3"})
 	assert.Equal(t, []string{"tag1", "tag2", "tag3"}, tags)
 }
+
+func TestAnnotatorWithSink(t *testing.T) {
+	tagExtractorMock := new(tagextractor.MockTagExtractor)
+	cacheMock := new(MockRegionMatcher)
+	sinkMock := new(MockSink)
+	defer func() {
+		tagExtractorMock.AssertExpectations(t)
+		cacheMock.AssertExpectations(t)
+		sinkMock.AssertExpectations(t)
+	}()
+
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	end := start.Add(time.Hour)
+	a := NewAnnotator("notification-center", sinkMock, []string{"nas"}, tagExtractorMock, cacheMock, log.New(io.Discard, "", 0))
+
+	tagExtractorMock.On("Extract", "[Malware Remover] Started scanning.").Once().Return("Started scanning.", []string{"Malware Remover"})
+	cacheMock.On("Match", "[Malware Remover] Started scanning.").Once().Return(-1)
+	sinkMock.On("Create", Annotation{Text: "Started scanning.", Tags: []string{"nas", "Malware Remover"}, Source: "notification-center", Time: start}).Once().Return(7, nil)
+	cacheMock.On("Add", 7, "[Malware Remover] Started scanning.").Once()
+
+	id, err := a.Post("[Malware Remover] Started scanning.", start)
+	require.NoError(t, err)
+	assert.Equal(t, 7, id)
+
+	tagExtractorMock.On("Extract", "[Malware Remover] Scan completed.").Once().Return("Scan completed.", []string{"Malware Remover"})
+	cacheMock.On("Match", "[Malware Remover] Scan completed.").Once().Return(7)
+	sinkMock.On("Update", 7, Annotation{Text: "Scan completed.", Tags: []string{"nas", "Malware Remover"}, Source: "notification-center", Time: end, TimeEnd: end}).Once().Return(7, nil)
+
+	id, err = a.Post("[Malware Remover] Scan completed.", end)
+	require.NoError(t, err)
+	assert.Equal(t, 7, id)
+}
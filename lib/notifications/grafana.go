@@ -0,0 +1,111 @@
+package notifications
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+)
+
+type grafanaAnnotation struct {
+	ID      int      `json:"id,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Time    int64    `json:"time,omitempty"`
+	TimeEnd int64    `json:"timeEnd,omitempty"`
+	Text    string   `json:"text,omitempty"`
+}
+
+type httpClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+type grafanaSink struct {
+	grafanaURL       string
+	grafanaAuthToken string
+	client           httpClient
+	logger           *log.Logger
+}
+
+// NewGrafanaSink returns a Sink that stores annotations through the Grafana
+// annotations API, updating them into regions when matched.
+func NewGrafanaSink(grafanaURL, grafanaAuthToken string, c httpClient, logger *log.Logger) Sink {
+	return &grafanaSink{
+		grafanaURL:       grafanaURL,
+		grafanaAuthToken: grafanaAuthToken,
+		client:           c,
+		logger:           logger,
+	}
+}
+
+func (s *grafanaSink) Create(a Annotation) (int, error) {
+	ga := grafanaAnnotation{
+		Text: a.Text,
+		Tags: a.Tags,
+		Time: a.Time.UnixNano() / 1000000,
+	}
+
+	return s.send("POST", fmt.Sprintf("%s/api/annotations", s.grafanaURL), ga)
+}
+
+func (s *grafanaSink) Update(id int, a Annotation) (int, error) {
+	ga := grafanaAnnotation{
+		Text:    a.Text,
+		Tags:    a.Tags,
+		TimeEnd: a.TimeEnd.UnixNano() / 1000000,
+	}
+
+	return s.send("PATCH", fmt.Sprintf("%s/api/annotations/%d", s.grafanaURL, id), ga)
+}
+
+func (s *grafanaSink) Close() {
+}
+
+func (s *grafanaSink) send(reqType, url string, ga grafanaAnnotation) (int, error) {
+	jsonBytes, err := json.Marshal(ga)
+	if err != nil {
+		s.logger.Printf("Error marshalling Grafana annotation: %v\n", err)
+		return -1, err
+	}
+	bodyReader := bytes.NewReader(jsonBytes)
+
+	req, err := http.NewRequest(reqType, url, bodyReader)
+	if err != nil {
+		s.logger.Printf("Error creating Grafana annotation request: %v\n", err)
+		return -1, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.grafanaAuthToken != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", s.grafanaAuthToken))
+	}
+
+	resp, err := s.client.Do(req)
+	if err == nil {
+		if resp.StatusCode < 300 {
+			body, readErr := io.ReadAll(resp.Body)
+			if readErr != nil {
+				return -1, fmt.Errorf("reading response body: %w", readErr)
+			}
+
+			var response struct {
+				ID      int    `json:"id"`
+				Message string `json:"message"`
+			}
+			err = json.Unmarshal(body, &response)
+			if err != nil {
+				return -1, fmt.Errorf("unmarshaling response body: %w", err)
+			}
+
+			s.logger.Printf("%s (status: %q), ID: %d\n", response.Message, resp.Status, response.ID)
+			return response.ID, nil
+		}
+
+		s.logger.Printf("Error creating Grafana annotation at %s: HTTP %d %q\n", url, resp.StatusCode, resp.Status)
+		err = fmt.Errorf("call to %s failed with HTTP %d %q", url, resp.StatusCode, resp.Status)
+	} else {
+		s.logger.Printf("Error creating Grafana annotation at %s: %v\n", url, err)
+	}
+
+	return -1, err
+}
@@ -0,0 +1,354 @@
+package notifications
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	lokiBatchSize  = 100
+	lokiBatchWait  = 5 * time.Second
+	lokiMaxRetries = 5
+	lokiRetryDelay = time.Second
+	lokiQueueSize  = 1000
+	// lokiCloseMaxRetries is the number of times a failed push is retried while the sink is closing
+	lokiCloseMaxRetries = 1
+)
+
+// lokiConfig controls how the Loki sink batches and retries the pushes
+type lokiConfig struct {
+	// batchSize is the number of entries that triggers a push
+	batchSize int
+	// batchWait is the maximum time an entry waits for its batch to be pushed
+	batchWait time.Duration
+	// maxRetries is the number of times a failed push is retried before its entries are dropped
+	maxRetries int
+	// retryDelay is the delay before the first retry, doubled for each subsequent one
+	retryDelay time.Duration
+}
+
+type lokiEntry struct {
+	labels   map[string]string
+	metadata map[string]string
+	time     time.Time
+	line     string
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values []lokiValue       `json:"values"`
+}
+
+// lokiValue is a log line, sent as a [<timestamp>, <line>, <structured metadata>] array
+type lokiValue struct {
+	Time     string
+	Line     string
+	Metadata map[string]string
+}
+
+func (v lokiValue) MarshalJSON() ([]byte, error) {
+	value := []any{v.Time, v.Line}
+	if len(v.Metadata) > 0 {
+		value = append(value, v.Metadata)
+	}
+
+	return json.Marshal(value)
+}
+
+func (v *lokiValue) UnmarshalJSON(data []byte) error {
+	var value []json.RawMessage
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	if len(value) < 2 {
+		return fmt.Errorf("unexpected Loki value: %s", data)
+	}
+
+	if err := json.Unmarshal(value[0], &v.Time); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(value[1], &v.Line); err != nil {
+		return err
+	}
+	if len(value) > 2 {
+		return json.Unmarshal(value[2], &v.Metadata)
+	}
+
+	return nil
+}
+
+type lokiPushRequest struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiSink struct {
+	pushURL string
+	tenant  string
+	client  httpClient
+	config  lokiConfig
+	logger  *log.Logger
+
+	entries chan lokiEntry
+	closing chan struct{}
+	done    chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+	lastID int
+}
+
+// NewLokiSink returns a Sink that pushes annotations as log lines to the Loki
+// push API, labelled with their source and carrying their tags as structured metadata.
+// The lines are sent in batches, retrying failed pushes with an exponential backoff.
+func NewLokiSink(lokiURL, tenant string, c httpClient, logger *log.Logger) Sink {
+	return newLokiSink(lokiURL, tenant, c, lokiConfig{
+		batchSize:  lokiBatchSize,
+		batchWait:  lokiBatchWait,
+		maxRetries: lokiMaxRetries,
+		retryDelay: lokiRetryDelay,
+	}, logger)
+}
+
+func newLokiSink(lokiURL, tenant string, c httpClient, config lokiConfig, logger *log.Logger) *lokiSink {
+	s := &lokiSink{
+		pushURL: fmt.Sprintf("%s/loki/api/v1/push", strings.TrimSuffix(lokiURL, "/")),
+		tenant:  tenant,
+		client:  c,
+		config:  config,
+		logger:  logger,
+		entries: make(chan lokiEntry, lokiQueueSize),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+
+	return s
+}
+
+func (s *lokiSink) Create(a Annotation) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.enqueue(a, a.Time); err != nil {
+		return -1, err
+	}
+
+	// Loki has no identifiers for log lines, but returning one allows the router to pass on the end of the region
+	s.lastID++
+
+	return s.lastID, nil
+}
+
+// Update pushes the annotation ending a region as a new log line, as log lines cannot be changed in Loki
+func (s *lokiSink) Update(id int, a Annotation) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.enqueue(a, a.TimeEnd); err != nil {
+		return -1, err
+	}
+
+	return id, nil
+}
+
+// Close pushes the pending entries and waits for the push to complete, cutting the
+// retries short so that the shutdown is not delayed by an unavailable Loki
+func (s *lokiSink) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.closing)
+		close(s.entries)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+}
+
+// enqueue adds the annotation to the next batch. It must be called with s.mu held.
+func (s *lokiSink) enqueue(a Annotation, t time.Time) error {
+	if s.closed {
+		return fmt.Errorf("loki sink is closed, dropping annotation %q", a.Text)
+	}
+
+	entry := lokiEntry{labels: lokiLabels(a), metadata: lokiMetadata(a), time: t, line: a.Text}
+	select {
+	case s.entries <- entry:
+		return nil
+	default:
+		return fmt.Errorf("loki queue is full, dropping annotation %q", a.Text)
+	}
+}
+
+// lokiLabels returns the stream labels of the annotation. The tags are not labels, as each combination
+// of them, e.g. with the container names, would create its own stream.
+func lokiLabels(a Annotation) map[string]string {
+	labels := map[string]string{"job": "qnapexporter"}
+	if a.Source != "" {
+		labels["source"] = a.Source
+	}
+
+	return labels
+}
+
+// lokiMetadata returns the structured metadata of the annotation log line, with its tags joined in a
+// single entry that can be matched with e.g. {source="docker"} | tags=~".*plex.*"
+func lokiMetadata(a Annotation) map[string]string {
+	var tags []string
+	for _, tag := range a.Tags {
+		if tag != "" && tag != a.Source && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	return map[string]string{"tags": strings.Join(tags, ",")}
+}
+
+func (s *lokiSink) run() {
+	defer close(s.done)
+
+	var batch []lokiEntry
+	timer := time.NewTimer(s.config.batchWait)
+	defer timer.Stop()
+
+	for {
+		select {
+		case entry, ok := <-s.entries:
+			if !ok {
+				s.push(batch)
+				return
+			}
+
+			batch = append(batch, entry)
+			if len(batch) >= s.config.batchSize {
+				s.push(batch)
+				batch = nil
+			}
+		case <-timer.C:
+			s.push(batch)
+			batch = nil
+			timer.Reset(s.config.batchWait)
+		}
+	}
+}
+
+func (s *lokiSink) push(batch []lokiEntry) {
+	if len(batch) == 0 {
+		return
+	}
+
+	jsonBytes, err := json.Marshal(newLokiPushRequest(batch))
+	if err != nil {
+		s.logger.Printf("Error marshalling Loki push request: %v\n", err)
+		return
+	}
+
+	delay := s.config.retryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := s.send(jsonBytes)
+		if err == nil {
+			return
+		}
+
+		maxRetries := s.config.maxRetries
+		if s.isClosing() {
+			maxRetries = min(maxRetries, lokiCloseMaxRetries)
+		}
+		if !retry || attempt >= maxRetries {
+			s.logger.Printf("Error pushing %d entries to Loki, dropping them: %v\n", len(batch), err)
+			return
+		}
+
+		s.logger.Printf("Error pushing %d entries to Loki, retrying in %v: %v\n", len(batch), delay, err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-s.closing:
+			// Retry right away, within the shorter budget of a closing sink
+			timer.Stop()
+		}
+		delay *= 2
+	}
+}
+
+func (s *lokiSink) isClosing() bool {
+	select {
+	case <-s.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// send posts the push request to Loki, returning whether it should be retried if it failed
+func (s *lokiSink) send(jsonBytes []byte) (bool, error) {
+	req, err := http.NewRequest("POST", s.pushURL, bytes.NewReader(jsonBytes))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.tenant != "" {
+		req.Header.Set("X-Scope-OrgID", s.tenant)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	body, _ := io.ReadAll(resp.Body)
+	err = fmt.Errorf("call to %s failed with HTTP %d %q: %s", s.pushURL, resp.StatusCode, resp.Status, strings.TrimSpace(string(body)))
+
+	// Requests rejected by Loki, e.g. for being out of order, would be rejected again
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// newLokiPushRequest groups the entries by their labels into streams
+func newLokiPushRequest(batch []lokiEntry) lokiPushRequest {
+	var req lokiPushRequest
+	streamIndexes := make(map[string]int)
+	for _, entry := range batch {
+		key := lokiStreamKey(entry.labels)
+		idx, ok := streamIndexes[key]
+		if !ok {
+			idx = len(req.Streams)
+			streamIndexes[key] = idx
+			req.Streams = append(req.Streams, lokiStream{Stream: entry.labels})
+		}
+
+		req.Streams[idx].Values = append(req.Streams[idx].Values, lokiValue{
+			Time:     strconv.FormatInt(entry.time.UnixNano(), 10),
+			Line:     entry.line,
+			Metadata: entry.metadata,
+		})
+	}
+
+	return req
+}
+
+func lokiStreamKey(labels map[string]string) string {
+	pairs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", k, v))
+	}
+	slices.Sort(pairs)
+
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,242 @@
+package notifications
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// lokiStandIn is a local stand-in of the Loki push API, failing the first requests with the given status
+type lokiStandIn struct {
+	mu             sync.Mutex
+	failures       int
+	failureStatus  int
+	attempts       int
+	requests       []lokiPushRequest
+	tenantHeaders  []string
+	contentHeaders []string
+}
+
+func (l *lokiStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.attempts++
+	if r.URL.Path != "/loki/api/v1/push" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if l.failures > 0 {
+		l.failures--
+		w.WriteHeader(l.failureStatus)
+		return
+	}
+
+	var req lokiPushRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	l.requests = append(l.requests, req)
+	l.tenantHeaders = append(l.tenantHeaders, r.Header.Get("X-Scope-OrgID"))
+	l.contentHeaders = append(l.contentHeaders, r.Header.Get("Content-Type"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newTestLokiSink(t *testing.T, standIn *lokiStandIn, batchSize int, batchWait time.Duration) *lokiSink {
+	t.Helper()
+
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+
+	return newLokiSink(server.URL+"/", "nas", server.Client(), lokiConfig{
+		batchSize:  batchSize,
+		batchWait:  batchWait,
+		maxRetries: 2,
+		retryDelay: time.Millisecond,
+	}, log.New(io.Discard, "", 0))
+}
+
+func TestLokiSink(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	standIn := &lokiStandIn{}
+	s := newTestLokiSink(t, standIn, 2, time.Hour)
+
+	id, err := s.Create(Annotation{Text: "[media] [plex] container die", Tags: []string{"nas", "docker", "media", "plex"}, Source: "docker", Time: start})
+	require.NoError(t, err)
+	assert.Equal(t, 1, id)
+	id, err = s.Create(Annotation{Text: "Scan completed.", Tags: []string{"nas", "notification-center", "Malware Remover"}, Source: "notification-center", Time: start.Add(time.Second)})
+	require.NoError(t, err)
+	assert.Equal(t, 2, id)
+
+	// The end of a region is pushed as a new log line
+	id, err = s.Update(1, Annotation{Text: "[media] [plex] container start", Tags: []string{"nas", "docker", "media", "plex"}, Source: "docker", Time: start.Add(time.Minute), TimeEnd: start.Add(time.Minute)})
+	require.NoError(t, err)
+	assert.Equal(t, 1, id)
+
+	// The first two entries are pushed as a full batch, and the last one when closing the sink
+	s.Close()
+
+	require.Len(t, standIn.requests, 2)
+	assert.Equal(t, []string{"nas", "nas"}, standIn.tenantHeaders)
+	assert.Equal(t, []string{"application/json", "application/json"}, standIn.contentHeaders)
+	assert.Equal(t, []lokiStream{
+		{
+			Stream: map[string]string{"job": "qnapexporter", "source": "docker"},
+			Values: []lokiValue{{Time: "1577880000000000000", Line: "[media] [plex] container die", Metadata: map[string]string{"tags": "nas,media,plex"}}},
+		},
+		{
+			Stream: map[string]string{"job": "qnapexporter", "source": "notification-center"},
+			Values: []lokiValue{{Time: "1577880001000000000", Line: "Scan completed.", Metadata: map[string]string{"tags": "nas,Malware Remover"}}},
+		},
+	}, standIn.requests[0].Streams)
+	assert.Equal(t, []lokiStream{
+		{
+			Stream: map[string]string{"job": "qnapexporter", "source": "docker"},
+			Values: []lokiValue{{Time: "1577880060000000000", Line: "[media] [plex] container start", Metadata: map[string]string{"tags": "nas,media,plex"}}},
+		},
+	}, standIn.requests[1].Streams)
+}
+
+func TestLokiPushRequestJSON(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	req := newLokiPushRequest([]lokiEntry{
+		{labels: map[string]string{"job": "qnapexporter"}, time: start, line: "first"},
+		{labels: map[string]string{"job": "qnapexporter"}, metadata: map[string]string{"tags": "nas"}, time: start.Add(time.Second), line: "second"},
+	})
+
+	jsonBytes, err := json.Marshal(req)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"streams": [{
+		"stream": {"job": "qnapexporter"},
+		"values": [["1577880000000000000", "first"], ["1577880001000000000", "second", {"tags": "nas"}]]
+	}]}`, string(jsonBytes))
+}
+
+func TestLokiSinkRetries(t *testing.T) {
+	testCases := map[string]struct {
+		failures         int
+		failureStatus    int
+		expectedAttempts int
+		expectedRequests int
+	}{
+		"recovers from server errors": {
+			failures:         2,
+			failureStatus:    http.StatusServiceUnavailable,
+			expectedAttempts: 3,
+			expectedRequests: 1,
+		},
+		"recovers from rate limiting": {
+			failures:         1,
+			failureStatus:    http.StatusTooManyRequests,
+			expectedAttempts: 2,
+			expectedRequests: 1,
+		},
+		"drops entries after the maximum retries": {
+			failures:         5,
+			failureStatus:    http.StatusInternalServerError,
+			expectedAttempts: 3,
+			expectedRequests: 0,
+		},
+		"does not retry rejected entries": {
+			failures:         1,
+			failureStatus:    http.StatusBadRequest,
+			expectedAttempts: 1,
+			expectedRequests: 0,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			standIn := &lokiStandIn{failures: tc.failures, failureStatus: tc.failureStatus}
+			s := newTestLokiSink(t, standIn, 1, time.Hour)
+
+			_, err := s.Create(Annotation{Text: "test notification", Source: "notification-center", Time: time.Now()})
+			require.NoError(t, err)
+
+			// Wait for the retries before closing the sink, which would cut them short
+			assert.Eventually(t, func() bool {
+				standIn.mu.Lock()
+				defer standIn.mu.Unlock()
+
+				return standIn.attempts == tc.expectedAttempts
+			}, time.Second, time.Millisecond)
+			s.Close()
+
+			assert.Equal(t, tc.expectedAttempts, standIn.attempts)
+			assert.Len(t, standIn.requests, tc.expectedRequests)
+		})
+	}
+}
+
+func TestLokiSinkCloseCutsRetries(t *testing.T) {
+	standIn := &lokiStandIn{failures: 100, failureStatus: http.StatusServiceUnavailable}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+	s := newLokiSink(server.URL, "", server.Client(), lokiConfig{
+		batchSize:  1,
+		batchWait:  time.Hour,
+		maxRetries: 5,
+		retryDelay: time.Hour,
+	}, log.New(io.Discard, "", 0))
+
+	_, err := s.Create(Annotation{Text: "test notification", Source: "notification-center", Time: time.Now()})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		standIn.mu.Lock()
+		defer standIn.mu.Unlock()
+
+		return standIn.attempts == 1
+	}, time.Second, time.Millisecond)
+
+	// Closing the sink interrupts the backoff and retries only once
+	closed := make(chan struct{})
+	go func() {
+		s.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "closing the sink waited for the backoff")
+	}
+
+	assert.Equal(t, 1+lokiCloseMaxRetries, standIn.attempts)
+	assert.Empty(t, standIn.requests)
+}
+
+func TestLokiSinkBatchWait(t *testing.T) {
+	standIn := &lokiStandIn{}
+	s := newTestLokiSink(t, standIn, 100, 10*time.Millisecond)
+	defer s.Close()
+
+	_, err := s.Create(Annotation{Text: "test notification", Source: "notification-center", Time: time.Now()})
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		standIn.mu.Lock()
+		defer standIn.mu.Unlock()
+
+		return len(standIn.requests) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestLokiSinkClosed(t *testing.T) {
+	standIn := &lokiStandIn{}
+	s := newTestLokiSink(t, standIn, 100, time.Hour)
+	s.Close()
+	s.Close()
+
+	id, err := s.Create(Annotation{Text: "test notification", Source: "notification-center", Time: time.Now()})
+	require.Error(t, err)
+	assert.Equal(t, -1, id)
+	assert.Zero(t, standIn.attempts)
+}
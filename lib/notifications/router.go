@@ -0,0 +1,129 @@
+package notifications
+
+import (
+	"errors"
+	"log"
+	"slices"
+	"sync"
+)
+
+// maxRoutedAnnotations is the number of recent annotations whose identifiers in each sink are remembered,
+// so that they can later be updated into regions
+const maxRoutedAnnotations = 100
+
+// Route sends the annotations that pass its filters to a sink
+type Route struct {
+	Sink Sink
+	// Sources lists the sources whose annotations are sent to the sink, or all sources if empty
+	Sources []string
+	// Tags lists the tags of which an annotation needs at least one to be sent to the sink, or any tags if empty
+	Tags []string
+}
+
+func (r Route) matches(a Annotation) bool {
+	if len(r.Sources) > 0 && !slices.Contains(r.Sources, a.Source) {
+		return false
+	}
+
+	return len(r.Tags) == 0 || slices.ContainsFunc(a.Tags, func(tag string) bool {
+		return slices.Contains(r.Tags, tag)
+	})
+}
+
+type routedAnnotation struct {
+	id int
+	// sinkIDs maps the index of each route the annotation was sent to, to the identifier in its sink
+	sinkIDs map[int]int
+}
+
+type router struct {
+	routes []Route
+	logger *log.Logger
+
+	mu          sync.Mutex
+	lastID      int
+	annotations []routedAnnotation
+}
+
+// NewRouter returns a Sink that sends each annotation to the sinks of all the
+// routes it matches.
+func NewRouter(routes []Route, logger *log.Logger) Sink {
+	return &router{
+		routes: routes,
+		logger: logger,
+	}
+}
+
+func (r *router) Create(a Annotation) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.create(a)
+}
+
+// create sends the annotation to the sinks of the matching routes. It must be called with r.mu held.
+func (r *router) create(a Annotation) (int, error) {
+	sinkIDs := make(map[int]int)
+	var errs []error
+	for idx, route := range r.routes {
+		if !route.matches(a) {
+			continue
+		}
+
+		id, err := route.Sink.Create(a)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		sinkIDs[idx] = id
+	}
+	if len(sinkIDs) == 0 {
+		// Also returns no error if no route matched the annotation
+		return -1, errors.Join(errs...)
+	}
+	if len(errs) > 0 {
+		r.logger.Printf("Error sending annotation to some of the sinks: %v\n", errors.Join(errs...))
+	}
+
+	r.lastID++
+	r.annotations = append(r.annotations, routedAnnotation{id: r.lastID, sinkIDs: sinkIDs})
+	if len(r.annotations) > maxRoutedAnnotations {
+		r.annotations = r.annotations[1:]
+	}
+
+	return r.lastID, nil
+}
+
+func (r *router) Update(id int, a Annotation) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	idx := slices.IndexFunc(r.annotations, func(ra routedAnnotation) bool { return ra.id == id })
+	if idx == -1 {
+		// The start of the region is too old to be remembered, so its end is stored as a new annotation
+		// rather than being lost
+		r.logger.Printf("Annotation %d is no longer known, creating a new annotation for the end of its region\n", id)
+		return r.create(a)
+	}
+	routed := r.annotations[idx]
+	r.annotations = slices.Delete(r.annotations, idx, idx+1)
+
+	// The region is updated in the sinks that received its start, even if the end no longer matches the route
+	var errs []error
+	for routeIdx, sinkID := range routed.sinkIDs {
+		if _, err := r.routes[routeIdx].Sink.Update(sinkID, a); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == len(routed.sinkIDs) {
+		return -1, errors.Join(errs...)
+	}
+
+	return id, nil
+}
+
+func (r *router) Close() {
+	for _, route := range r.routes {
+		route.Sink.Close()
+	}
+}
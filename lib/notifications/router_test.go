@@ -0,0 +1,131 @@
+package notifications
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	dockerStop := Annotation{Text: "container stop", Tags: []string{"nas", "docker", "plex"}, Source: "docker", Time: start}
+	dockerStart := Annotation{Text: "container start", Tags: []string{"nas", "docker", "plex"}, Source: "docker", Time: start.Add(time.Minute), TimeEnd: start.Add(time.Minute)}
+	notification := Annotation{Text: "Scan completed.", Tags: []string{"nas", "Malware Remover"}, Source: "notification-center", Time: start}
+
+	allSink := new(MockSink)
+	dockerSink := new(MockSink)
+	malwareSink := new(MockSink)
+	defer func() {
+		allSink.AssertExpectations(t)
+		dockerSink.AssertExpectations(t)
+		malwareSink.AssertExpectations(t)
+	}()
+
+	r := NewRouter([]Route{
+		{Sink: allSink},
+		{Sink: dockerSink, Sources: []string{"docker"}},
+		{Sink: malwareSink, Tags: []string{"Malware Remover", "Antivirus"}},
+	}, log.New(io.Discard, "", 0))
+
+	allSink.On("Create", dockerStop).Once().Return(10, nil)
+	dockerSink.On("Create", dockerStop).Once().Return(20, nil)
+	id, err := r.Create(dockerStop)
+	require.NoError(t, err)
+	assert.Equal(t, 1, id)
+
+	allSink.On("Create", notification).Once().Return(11, nil)
+	malwareSink.On("Create", notification).Once().Return(30, nil)
+	id, err = r.Create(notification)
+	require.NoError(t, err)
+	assert.Equal(t, 2, id)
+
+	// The region is updated with the identifiers of each sink
+	allSink.On("Update", 10, dockerStart).Once().Return(10, nil)
+	dockerSink.On("Update", 20, dockerStart).Once().Return(20, nil)
+	id, err = r.Update(1, dockerStart)
+	require.NoError(t, err)
+	assert.Equal(t, 1, id)
+
+	// A region can only be closed once, after which its end is created as a new annotation
+	allSink.On("Create", dockerStart).Once().Return(12, nil)
+	dockerSink.On("Create", dockerStart).Once().Return(21, nil)
+	id, err = r.Update(1, dockerStart)
+	require.NoError(t, err)
+	assert.Equal(t, 3, id)
+}
+
+func TestRouterErrors(t *testing.T) {
+	a := Annotation{Text: "test notification", Source: "docker"}
+	failingSink := new(MockSink)
+	sink := new(MockSink)
+	defer func() {
+		failingSink.AssertExpectations(t)
+		sink.AssertExpectations(t)
+	}()
+
+	r := NewRouter([]Route{
+		{Sink: failingSink},
+		{Sink: sink, Sources: []string{"notification-center"}},
+	}, log.New(io.Discard, "", 0))
+
+	failingSink.On("Create", a).Once().Return(-1, assert.AnError)
+	id, err := r.Create(a)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, -1, id)
+
+	// No route matches
+	r = NewRouter([]Route{{Sink: sink, Sources: []string{"notification-center"}}}, log.New(io.Discard, "", 0))
+	id, err = r.Create(a)
+	assert.NoError(t, err)
+	assert.Equal(t, -1, id)
+}
+
+func TestRouterForgetsOldAnnotations(t *testing.T) {
+	sink := new(MockSink)
+	r := NewRouter([]Route{{Sink: sink}}, log.New(io.Discard, "", 0))
+
+	sink.On("Create", Annotation{}).Return(1, nil)
+	for range maxRoutedAnnotations + 1 {
+		_, err := r.Create(Annotation{})
+		require.NoError(t, err)
+	}
+
+	// The evicted annotation is no longer updated, but its region end is created as a new annotation
+	end := Annotation{Text: "container start", Source: "docker"}
+	sink.On("Create", end).Once().Return(2, nil)
+	id, err := r.Update(1, end)
+	assert.NoError(t, err)
+	assert.Equal(t, maxRoutedAnnotations+2, id)
+
+	// Creating the region end evicted the next oldest annotation
+	sink.On("Update", 1, Annotation{}).Once().Return(1, nil)
+	id, err = r.Update(3, Annotation{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, id)
+	sink.AssertExpectations(t)
+}
+
+func TestRouterUpdateUnknownAnnotation(t *testing.T) {
+	end := Annotation{Text: "container start", Source: "docker"}
+	dockerSink := new(MockSink)
+	otherSink := new(MockSink)
+	defer func() {
+		dockerSink.AssertExpectations(t)
+		otherSink.AssertExpectations(t)
+	}()
+
+	r := NewRouter([]Route{
+		{Sink: dockerSink, Sources: []string{"docker"}},
+		{Sink: otherSink, Sources: []string{"notification-center"}},
+	}, log.New(io.Discard, "", 0))
+
+	// Only the routes matching the annotation receive it
+	dockerSink.On("Create", end).Once().Return(-1, assert.AnError)
+	id, err := r.Update(42, end)
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Equal(t, -1, id)
+}
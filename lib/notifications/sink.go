@@ -0,0 +1,24 @@
+package notifications
+
+import "time"
+
+// Annotation is an event recorded by a Sink
+type Annotation struct {
+	Text string
+	Tags []string
+	// Source identifies what produced the annotation, e.g. the QNAP Notification Center or Docker
+	Source string
+	Time   time.Time
+	// TimeEnd is set when the annotation ends a region started by a previous annotation
+	TimeEnd time.Time
+}
+
+// Sink stores annotations in a backend, such as Grafana.
+type Sink interface {
+	// Create stores a new annotation, returning its identifier in the backend
+	Create(a Annotation) (int, error)
+	// Update ends the region started by the annotation with the given identifier at a.TimeEnd
+	Update(id int, a Annotation) (int, error)
+	// Close delivers any buffered annotations and releases the sink
+	Close()
+}
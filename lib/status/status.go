@@ -91,6 +91,7 @@ func (s *Status) WriteHTML(w io.Writer) error {
 		Path: s.MetricsEndpoint,
 		Properties: map[string]string{
 			"Version":       utils.VERSION,
+			"Platform":      e.Platform,
 			"Revision":      utils.REVISION,
 			"Uptime":        humanizeTime(e.Uptime),
 			"Last fetch":    humanizeTime(e.LastFetch),
@@ -102,8 +103,9 @@ func (s *Status) WriteHTML(w io.Writer) error {
 			"Interfaces":    humanizeList(e.Interfaces),
 			"Enclosures":    humanizeList(e.Enclosures),
 			"dm-caches":     humanizeList(e.DmCaches),
-			"dm-volume":     e.DmCacheDevice,
+			"dm-volumes":    humanizeList(e.DmCacheDevices),
 			"Docker":        e.Docker,
+			"Libvirt":       e.Libvirt,
 		},
 	}
 	endpoints := []endpointStatus{ms}
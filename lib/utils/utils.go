@@ -28,6 +28,20 @@ func ReadFileLines(f string) ([]string, error) {
 	return strings.Split(contents, "\n"), nil
 }
 
+// LookPath returns the path of the first of the given executables that is found, searching the PATH
+// for names without a slash
+func LookPath(names ...string) (string, error) {
+	err := exec.ErrNotFound
+	for _, name := range names {
+		var path string
+		if path, err = exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+
+	return "", err
+}
+
 // ExecCommand executes a command and returns the standard output, as well as any error
 func ExecCommand(cmd string, args ...string) (string, error) {
 	var (
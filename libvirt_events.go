@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pedropombeiro/qnapexporter/lib/exporter"
+	"github.com/pedropombeiro/qnapexporter/lib/exporter/prometheus"
+	"github.com/pedropombeiro/qnapexporter/lib/notifications"
+	"github.com/pedropombeiro/qnapexporter/lib/utils"
+)
+
+const (
+	libvirtEventTimeLayout = "2006-01-02 15:04:05.000-0700"
+	libvirtRetryDelay      = time.Minute
+)
+
+// libvirtEventRe matches the lines printed by `virsh event --timestamp`, e.g.
+// 2026-10-19 10:00:00.123+0000: event 'lifecycle' for domain 'vm1': Started Booted
+var libvirtEventRe = regexp.MustCompile(`^(\S+ \S+): event '([^']+)' for domain '([^']+)': (.+)$`)
+
+// libvirtEvent is a VM lifecycle event reported by virsh
+type libvirtEvent struct {
+	time   time.Time
+	domain string
+	detail string
+}
+
+// handleLibvirtEvents forwards the lifecycle events of the Virtualization Station VMs as annotations,
+// restarting `virsh event` if it exits
+func handleLibvirtEvents(ctx context.Context, args httpServerArgs, annotator notifications.Annotator, exporterStatus *exporter.Status) error {
+	virsh, err := utils.LookPath("virsh", prometheus.QvsVirshPath)
+	if err != nil {
+		// Virtualization Station is not installed
+		exporterStatus.Libvirt = "virsh not found"
+		return nil
+	}
+
+	for {
+		err := watchLibvirtEvents(ctx, virsh, args, annotator, exporterStatus)
+		if ctx.Err() != nil {
+			exporterStatus.Libvirt = "Done"
+			return nil
+		}
+
+		exporterStatus.Libvirt = fmt.Sprintf("virsh event exited: %v", err)
+		args.logger.Println(exporterStatus.Libvirt)
+
+		select {
+		case <-time.After(libvirtRetryDelay):
+		case <-ctx.Done():
+			exporterStatus.Libvirt = "Done"
+			return nil
+		}
+	}
+}
+
+func watchLibvirtEvents(ctx context.Context, virsh string, args httpServerArgs, annotator notifications.Annotator, exporterStatus *exporter.Status) error {
+	cmd := exec.CommandContext(ctx, virsh, "event", "--event", "lifecycle", "--loop", "--timestamp")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exporterStatus.Libvirt = "Waiting for events"
+
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		event, ok := parseLibvirtEvent(scanner.Text())
+		if !ok {
+			continue
+		}
+
+		// The domain is prefixed in brackets so that it is turned into a Grafana tag
+		m := fmt.Sprintf("[%s] VM %s %s", event.domain, event.domain, event.detail)
+		exporterStatus.Libvirt = m
+		args.logger.Printf("%v: %s\n", event.time, m)
+		_, _ = annotator.Post(m, event.time)
+	}
+
+	return cmd.Wait()
+}
+
+// parseLibvirtEvent parses a line of `virsh event --timestamp`, e.g.
+// "2026-10-19 10:00:00.123+0000: event 'lifecycle' for domain 'vm1': Stopped Shutdown"
+func parseLibvirtEvent(line string) (libvirtEvent, bool) {
+	matches := libvirtEventRe.FindStringSubmatch(strings.TrimSpace(line))
+	if matches == nil {
+		return libvirtEvent{}, false
+	}
+
+	t, err := time.Parse(libvirtEventTimeLayout, matches[1])
+	if err != nil {
+		t = time.Now()
+	}
+
+	return libvirtEvent{time: t, domain: matches[3], detail: strings.ToLower(matches[4])}, true
+}
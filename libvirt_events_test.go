@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLibvirtEvent(t *testing.T) {
+	event, ok := parseLibvirtEvent("2026-10-19 10:00:00.123+0000: event 'lifecycle' for domain 'Home Assistant': Stopped Shutdown")
+
+	assert.True(t, ok)
+	assert.Equal(t, libvirtEvent{
+		time:   time.Date(2026, 10, 19, 10, 0, 0, 123000000, time.UTC),
+		domain: "Home Assistant",
+		detail: "stopped shutdown",
+	}, libvirtEvent{time: event.time.UTC(), domain: event.domain, detail: event.detail})
+
+	_, ok = parseLibvirtEvent("events received: 1")
+	assert.False(t, ok)
+}